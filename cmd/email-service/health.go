@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"aptiverse-email/internal/rabbitmq"
+)
+
+func serveHealth(addr string, consumer *rabbitmq.Consumer) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		state := consumer.State()
+
+		status := http.StatusOK
+		if state != rabbitmq.StateConnected {
+			status = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{
+			"status":   http.StatusText(status),
+			"rabbitmq": state.String(),
+		})
+	})
+
+	log.Printf("Health endpoint listening on %s", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Printf("Health endpoint stopped: %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"os/signal"
@@ -8,6 +9,7 @@ import (
 
 	"aptiverse-email/internal/config"
 	"aptiverse-email/internal/rabbitmq"
+	"aptiverse-email/internal/templates"
 )
 
 func main() {
@@ -16,6 +18,25 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if len(os.Args) > 1 && os.Args[1] == "preview" {
+		runPreview(ctx, cfg, os.Args[2:])
+		return
+	}
+
+	if dir := cfg.Email.TemplateDir; dir != "" {
+		if err := templates.Load(dir); err != nil {
+			log.Fatalf("Failed to load templates from %s:\n%v", dir, err)
+		}
+		log.Printf("Loaded templates: %v", templates.Names())
+
+		reload := make(chan os.Signal, 1)
+		signal.Notify(reload, syscall.SIGHUP)
+		go templates.Watch(ctx, dir, cfg.Email.TemplateReloadInterval, reload)
+	}
+
 	consumer, err := rabbitmq.NewConsumer(cfg)
 	if err != nil {
 		log.Fatalf("Failed to create consumer: %v", err)
@@ -26,14 +47,21 @@ func main() {
 		log.Fatalf("Failed to start consumer: %v", err)
 	}
 
-	log.Println("Email service started successfully")
+	if cfg.App.HealthAddr != "" {
+		go serveHealth(cfg.App.HealthAddr, consumer)
+	}
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	log.Println("Email service started successfully")
 
-	<-sigChan
+	<-ctx.Done()
 	log.Println("Shutdown signal received")
 
-	consumer.Stop()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.App.ShutdownTimeout)
+	defer cancel()
+
+	if err := consumer.Stop(shutdownCtx); err != nil {
+		log.Printf("Email service stopped before all in-flight emails finished: %v", err)
+		return
+	}
 	log.Println("Email service stopped gracefully")
-}
\ No newline at end of file
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/mail"
+	"sort"
+
+	"aptiverse-email/internal/config"
+	"aptiverse-email/internal/message"
+	"aptiverse-email/internal/templates"
+)
+
+// runPreview serves a local page for designers that renders each template
+// with its fixture data, and reloads itself when the template directory
+// changes. Nothing is sent and no broker is needed.
+func runPreview(ctx context.Context, cfg *config.Config, args []string) {
+	flags := flag.NewFlagSet("preview", flag.ExitOnError)
+	addr := flags.String("addr", "localhost:8025", "address to serve the preview on")
+	dir := flags.String("dir", cfg.Email.TemplateDir, "template directory to load and watch, defaults to TEMPLATE_DIR")
+	flags.Parse(args)
+
+	if *dir != "" {
+		// Unlike the service, the preview starts with broken templates so
+		// that the errors show on the page until they are fixed.
+		if err := templates.Load(*dir); err != nil {
+			log.Printf("Failed to load templates from %s:\n%v", *dir, err)
+		}
+		go templates.Watch(ctx, *dir, cfg.Email.TemplateReloadInterval, nil)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		page := newPreviewPage(cfg, r.URL.Query().Get("template"), r.URL.Query().Get("fixture"), r.URL.Query().Get("locale"))
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := previewTemplate.Execute(w, page); err != nil {
+			log.Printf("Failed to write preview page: %v", err)
+		}
+	})
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		flusher.Flush()
+
+		select {
+		case <-templates.Changed():
+			fmt.Fprint(w, "data: reload\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+		}
+	})
+
+	server := &http.Server{Addr: *addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	log.Printf("Template preview listening on http://%s", *addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("Template preview stopped: %v", err)
+	}
+}
+
+type previewPage struct {
+	Templates []string
+	Fixtures  []string
+	Locales   []string
+	Template  string
+	Fixture   string
+	Locale    string
+	LoadError error
+	Error     error
+	Subject   string
+	HTML      string
+	Text      string
+	MIME      string
+	Uninlined []string
+}
+
+// newPreviewPage renders the chosen template, falling back to the first
+// template, the "default" fixture and the "en" locale when none is chosen.
+func newPreviewPage(cfg *config.Config, name, fixture, locale string) *previewPage {
+	page := &previewPage{
+		Templates: templates.Names(),
+		Template:  name,
+		Fixture:   fixture,
+		Locale:    locale,
+		LoadError: templates.LoadError(),
+	}
+	if page.Template == "" && len(page.Templates) > 0 {
+		page.Template = page.Templates[0]
+	}
+
+	tmpl, ok := templates.Lookup(page.Template)
+	if !ok {
+		page.Error = fmt.Errorf("unknown template %q", page.Template)
+		return page
+	}
+
+	for name := range tmpl.Fixtures {
+		page.Fixtures = append(page.Fixtures, name)
+	}
+	sort.Strings(page.Fixtures)
+	if _, ok := tmpl.Fixtures[page.Fixture]; !ok {
+		page.Fixture = ""
+		if _, ok := tmpl.Fixtures["default"]; ok {
+			page.Fixture = "default"
+		} else if len(page.Fixtures) > 0 {
+			page.Fixture = page.Fixtures[0]
+		}
+	}
+	page.Locales = tmpl.Locales()
+	if page.Locale == "" {
+		page.Locale = "en"
+	}
+
+	data := tmpl.Fixtures[page.Fixture]
+	if data == nil {
+		data = map[string]any{}
+	}
+	rendered, err := tmpl.Render(data, templates.RenderOptions{Locale: page.Locale})
+	if err != nil {
+		page.Error = err
+		return page
+	}
+	page.Subject = rendered.Subject
+	page.HTML = rendered.HTML
+	page.Text = rendered.Text
+	page.Uninlined = rendered.UninlinedCSS
+
+	msg := &message.Message{
+		From:     previewAddress(cfg.SMTP.From, "Aptiverse <no-reply@aptiverse.co.za>"),
+		Subject:  rendered.Subject,
+		HTMLBody: rendered.HTML,
+		TextBody: rendered.Text,
+	}
+	to, _ := data["email"].(string)
+	msg.To = []mail.Address{previewAddress(to, "preview@example.com")}
+	raw, err := msg.Bytes()
+	if err != nil {
+		page.Error = err
+		return page
+	}
+	page.MIME = string(raw)
+	return page
+}
+
+func previewAddress(address, fallback string) mail.Address {
+	addr, err := mail.ParseAddress(address)
+	if err != nil {
+		addr, _ = mail.ParseAddress(fallback)
+	}
+	return *addr
+}
+
+var previewTemplate = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html lang='en'>
+<head>
+    <meta charset='UTF-8'>
+    <title>{{.Template}} - Template Preview</title>
+    <style>
+        body { margin: 0; font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; display: flex; height: 100vh; color: #1f2937; }
+        nav { width: 220px; padding: 16px; background: #f8fafc; border-right: 1px solid #e5e7eb; overflow-y: auto; }
+        nav a { display: block; padding: 6px 8px; border-radius: 6px; color: #374151; text-decoration: none; }
+        nav a.current { background: #667eea; color: white; }
+        main { flex: 1; display: flex; flex-direction: column; min-width: 0; }
+        header { padding: 12px 16px; border-bottom: 1px solid #e5e7eb; display: flex; gap: 16px; align-items: center; }
+        .subject { font-weight: 600; flex: 1; }
+        .error { margin: 0; padding: 12px 16px; background: #fef2f2; color: #991b1b; white-space: pre-wrap; }
+        .warning { margin: 0; padding: 12px 16px; background: #fef3c7; color: #92400e; white-space: pre-wrap; }
+        .panes { flex: 1; display: flex; min-height: 0; }
+        .pane { flex: 1; display: flex; flex-direction: column; min-width: 0; border-right: 1px solid #e5e7eb; }
+        .pane h2 { margin: 0; padding: 8px 16px; font-size: 13px; text-transform: uppercase; color: #6b7280; border-bottom: 1px solid #e5e7eb; }
+        .pane iframe { flex: 1; border: 0; }
+        .pane pre { flex: 1; margin: 0; padding: 16px; overflow: auto; font-size: 12px; }
+    </style>
+</head>
+<body>
+    <nav>
+        {{range .Templates}}<a href='?template={{.}}&amp;locale={{$.Locale}}'{{if eq . $.Template}} class='current'{{end}}>{{.}}</a>{{end}}
+    </nav>
+    <main>
+        <header>
+            <span class='subject'>{{.Subject}}</span>
+            <form>
+                <input type='hidden' name='template' value='{{.Template}}'>
+                <label>Fixture
+                    <select name='fixture' onchange='this.form.submit()'>
+                        {{range .Fixtures}}<option{{if eq . $.Fixture}} selected{{end}}>{{.}}</option>{{end}}
+                    </select>
+                </label>
+                <label>Locale
+                    <select name='locale' onchange='this.form.submit()'>
+                        {{range .Locales}}<option{{if eq . $.Locale}} selected{{end}}>{{.}}</option>{{end}}
+                    </select>
+                </label>
+            </form>
+        </header>
+        {{with .LoadError}}<pre class='error'>Failed to reload templates, showing the previous set:
+{{.}}</pre>{{end}}
+        {{with .Error}}<pre class='error'>{{.}}</pre>{{end}}
+        {{with .Uninlined}}<pre class='warning'>CSS that was not inlined:{{range .}}
+  {{.}}{{end}}</pre>{{end}}
+        <div class='panes'>
+            <section class='pane'><h2>HTML</h2><iframe srcdoc='{{.HTML}}'></iframe></section>
+            <section class='pane'><h2>Text</h2><pre>{{.Text}}</pre></section>
+            <section class='pane'><h2>MIME</h2><pre>{{.MIME}}</pre></section>
+        </div>
+    </main>
+    <script>
+        new EventSource('/events').onmessage = function() { location.reload(); };
+    </script>
+</body>
+</html>
+`))
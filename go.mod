@@ -2,4 +2,11 @@ module aptiverse-email
 
 go 1.21
 
-require github.com/rabbitmq/amqp091-go v1.10.0
+require (
+	github.com/emersion/go-msgauth v0.7.0
+	github.com/rabbitmq/amqp091-go v1.10.0
+	golang.org/x/net v0.25.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/crypto v0.31.0 // indirect
@@ -0,0 +1,44 @@
+package dedup
+
+import (
+	"fmt"
+
+	"aptiverse-email/internal/config"
+)
+
+type Status int
+
+const (
+	// Acquired means the caller now holds the key and should send the email.
+	Acquired Status = iota
+	// InProgress means another worker holds the key and has not finished.
+	InProgress
+	// Sent means the email was already sent within the dedup window.
+	Sent
+)
+
+// Store records which logical emails have been sent so that redelivered
+// messages are not sent twice.
+type Store interface {
+	// Acquire reserves key for sending unless it is already reserved or sent.
+	Acquire(key string) (Status, error)
+	// Complete marks key as sent for the rest of the dedup window.
+	Complete(key string) error
+	// Release drops the reservation after a failed attempt so the email can
+	// be retried.
+	Release(key string) error
+	Close() error
+}
+
+func New(cfg config.DedupConfig) (Store, error) {
+	switch cfg.Backend {
+	case "memory":
+		return NewMemoryStore(cfg.Capacity, cfg.Window), nil
+	case "redis":
+		return NewRedisStore(cfg)
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown dedup backend %q. Available backends: 'memory', 'redis', 'none'", cfg.Backend)
+	}
+}
@@ -0,0 +1,91 @@
+package dedup
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-process LRU of recently seen keys. Entries expire
+// after the dedup window, and the least recently used entry is evicted once
+// capacity is reached.
+type MemoryStore struct {
+	capacity int
+	window   time.Duration
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key     string
+	sent    bool
+	expires time.Time
+}
+
+func NewMemoryStore(capacity int, window time.Duration) *MemoryStore {
+	return &MemoryStore{
+		capacity: capacity,
+		window:   window,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (s *MemoryStore) Acquire(key string) (Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[key]; ok {
+		entry := el.Value.(*memoryEntry)
+		if time.Now().Before(entry.expires) {
+			s.order.MoveToFront(el)
+			if entry.sent {
+				return Sent, nil
+			}
+			return InProgress, nil
+		}
+		s.remove(el)
+	}
+
+	s.entries[key] = s.order.PushFront(&memoryEntry{
+		key:     key,
+		expires: time.Now().Add(s.window),
+	})
+	for s.capacity > 0 && s.order.Len() > s.capacity {
+		s.remove(s.order.Back())
+	}
+	return Acquired, nil
+}
+
+func (s *MemoryStore) Complete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[key]; ok {
+		entry := el.Value.(*memoryEntry)
+		entry.sent = true
+		entry.expires = time.Now().Add(s.window)
+	}
+	return nil
+}
+
+func (s *MemoryStore) Release(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[key]; ok && !el.Value.(*memoryEntry).sent {
+		s.remove(el)
+	}
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+func (s *MemoryStore) remove(el *list.Element) {
+	s.order.Remove(el)
+	delete(s.entries, el.Value.(*memoryEntry).key)
+}
@@ -0,0 +1,68 @@
+package dedup
+
+import (
+	"testing"
+	"time"
+)
+
+func acquire(t *testing.T, s Store, key string, want Status) {
+	t.Helper()
+	got, err := s.Acquire(key)
+	if err != nil {
+		t.Fatalf("Acquire(%q) failed: %v", key, err)
+	}
+	if got != want {
+		t.Fatalf("Acquire(%q) = %v, want %v", key, got, want)
+	}
+}
+
+func TestMemoryStoreTransitions(t *testing.T) {
+	s := NewMemoryStore(10, time.Hour)
+
+	acquire(t, s, "a", Acquired)
+	acquire(t, s, "a", InProgress)
+
+	// A failed attempt releases the key so a retry can send it.
+	s.Release("a")
+	acquire(t, s, "a", Acquired)
+
+	s.Complete("a")
+	acquire(t, s, "a", Sent)
+
+	// Releasing a sent key must not let it be sent again.
+	s.Release("a")
+	acquire(t, s, "a", Sent)
+
+	// Completing a key that was never acquired records nothing.
+	s.Complete("b")
+	acquire(t, s, "b", Acquired)
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	s := NewMemoryStore(10, 20*time.Millisecond)
+
+	acquire(t, s, "pending", Acquired)
+	acquire(t, s, "sent", Acquired)
+	s.Complete("sent")
+
+	time.Sleep(30 * time.Millisecond)
+	acquire(t, s, "pending", Acquired)
+	acquire(t, s, "sent", Acquired)
+}
+
+func TestMemoryStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	s := NewMemoryStore(2, time.Hour)
+
+	acquire(t, s, "a", Acquired)
+	acquire(t, s, "b", Acquired)
+	s.Complete("a")
+	s.Complete("b")
+
+	// Seeing "a" again makes "b" the least recently used entry.
+	acquire(t, s, "a", Sent)
+	acquire(t, s, "c", Acquired)
+
+	acquire(t, s, "a", Sent)
+	acquire(t, s, "c", InProgress)
+	acquire(t, s, "b", Acquired)
+}
@@ -0,0 +1,225 @@
+package dedup
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"aptiverse-email/internal/config"
+)
+
+const (
+	redisPending = "pending"
+	redisSent    = "sent"
+)
+
+// RedisStore keeps dedup keys in Redis or any server that speaks the Redis
+// protocol, so that every service instance shares the same window. Pending
+// reservations expire after the lock TTL in case a worker dies mid-send.
+type RedisStore struct {
+	url     *url.URL
+	prefix  string
+	window  time.Duration
+	lockTTL time.Duration
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func NewRedisStore(cfg config.DedupConfig) (*RedisStore, error) {
+	u, err := url.Parse(cfg.RedisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DEDUP_REDIS_URL: %v", err)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("invalid DEDUP_REDIS_URL scheme %q, expected redis:// or rediss://", u.Scheme)
+	}
+
+	s := &RedisStore{
+		url:     u,
+		prefix:  cfg.KeyPrefix,
+		window:  cfg.Window,
+		lockTTL: cfg.LockTTL,
+	}
+	if _, err := s.do("PING"); err != nil {
+		return nil, fmt.Errorf("failed to connect to dedup redis: %v", err)
+	}
+	return s, nil
+}
+
+func (s *RedisStore) Acquire(key string) (Status, error) {
+	reply, err := s.do("SET", s.prefix+key, redisPending, "NX", "PX", strconv.FormatInt(s.lockTTL.Milliseconds(), 10))
+	if err != nil {
+		return 0, err
+	}
+	if reply != nil {
+		return Acquired, nil
+	}
+
+	reply, err = s.do("GET", s.prefix+key)
+	if err != nil {
+		return 0, err
+	}
+	if reply == redisSent {
+		return Sent, nil
+	}
+	return InProgress, nil
+}
+
+func (s *RedisStore) Complete(key string) error {
+	_, err := s.do("SET", s.prefix+key, redisSent, "PX", strconv.FormatInt(s.window.Milliseconds(), 10))
+	return err
+}
+
+func (s *RedisStore) Release(key string) error {
+	_, err := s.do("DEL", s.prefix+key)
+	return err
+}
+
+func (s *RedisStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// do sends one command and returns its reply: a string, an int64, nil for a
+// null reply, or an error for a Redis error reply. The connection is dropped
+// and redialled on the next call after any I/O failure.
+func (s *RedisStore) do(args ...string) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		if err := s.dial(); err != nil {
+			return nil, err
+		}
+	}
+
+	reply, err := s.roundTrip(args)
+	if err != nil {
+		var redisErr redisError
+		if !errors.As(err, &redisErr) {
+			s.conn.Close()
+			s.conn = nil
+		}
+		return nil, err
+	}
+	return reply, nil
+}
+
+func (s *RedisStore) dial() error {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+
+	var conn net.Conn
+	var err error
+	if s.url.Scheme == "rediss" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.url.Host, &tls.Config{ServerName: s.url.Hostname()})
+	} else {
+		conn, err = dialer.Dial("tcp", s.url.Host)
+	}
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	s.reader = bufio.NewReader(conn)
+
+	if password, ok := s.url.User.Password(); ok {
+		args := []string{"AUTH", password}
+		if user := s.url.User.Username(); user != "" {
+			args = []string{"AUTH", user, password}
+		}
+		if _, err := s.roundTrip(args); err != nil {
+			s.conn.Close()
+			s.conn = nil
+			return err
+		}
+	}
+
+	if db := strings.TrimPrefix(s.url.Path, "/"); db != "" && db != "0" {
+		if _, err := s.roundTrip([]string{"SELECT", db}); err != nil {
+			s.conn.Close()
+			s.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *RedisStore) roundTrip(args []string) (any, error) {
+	s.conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	var cmd strings.Builder
+	fmt.Fprintf(&cmd, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&cmd, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(s.conn, cmd.String()); err != nil {
+		return nil, err
+	}
+	return readReply(s.reader)
+}
+
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
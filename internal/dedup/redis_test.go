@@ -0,0 +1,238 @@
+package dedup
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"aptiverse-email/internal/config"
+)
+
+// fakeRedis answers the commands RedisStore sends, without expiry.
+type fakeRedis struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	values   map[string]string
+	commands [][]string
+	conns    int
+	// drop closes the connection instead of answering the next command.
+	drop bool
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{listener: listener, values: make(map[string]string)}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.conns++
+			f.mu.Unlock()
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) newStore(t *testing.T, window time.Duration) *RedisStore {
+	t.Helper()
+	s, err := NewRedisStore(config.DedupConfig{
+		RedisURL:  "redis://" + f.listener.Addr().String() + "/0",
+		KeyPrefix: "sent:",
+		Window:    window,
+		LockTTL:   5 * time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func (f *fakeRedis) connections() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.conns
+}
+
+func (f *fakeRedis) lastCommand() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.commands[len(f.commands)-1]
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			return
+		}
+		items, _ := reply.([]any)
+		args := make([]string, len(items))
+		for i, item := range items {
+			args[i], _ = item.(string)
+		}
+
+		f.mu.Lock()
+		if f.drop {
+			f.drop = false
+			f.mu.Unlock()
+			return
+		}
+		f.commands = append(f.commands, args)
+		answer := f.answer(args)
+		f.mu.Unlock()
+		io.WriteString(conn, answer)
+	}
+}
+
+func (f *fakeRedis) answer(args []string) string {
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "GET":
+		value, ok := f.values[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case "SET":
+		nx := false
+		for i := 3; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "NX":
+				nx = true
+			case "PX":
+				if ms, err := strconv.Atoi(args[i+1]); err != nil || ms <= 0 {
+					return "-ERR invalid expire time in 'set' command\r\n"
+				}
+				i++
+			}
+		}
+		if _, ok := f.values[args[1]]; ok && nx {
+			return "$-1\r\n"
+		}
+		f.values[args[1]] = args[2]
+		return "+OK\r\n"
+	case "DEL":
+		_, ok := f.values[args[1]]
+		delete(f.values, args[1])
+		if ok {
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	default:
+		return "-ERR unknown command '" + args[0] + "'\r\n"
+	}
+}
+
+func TestRedisStoreTransitions(t *testing.T) {
+	f := newFakeRedis(t)
+	s := f.newStore(t, 24*time.Hour)
+
+	acquire(t, s, "a", Acquired)
+	if got := strings.Join(f.lastCommand(), " "); got != "SET sent:a pending NX PX 300000" {
+		t.Errorf("Acquire sent %q", got)
+	}
+	acquire(t, s, "a", InProgress)
+
+	if err := s.Release("a"); err != nil {
+		t.Fatal(err)
+	}
+	acquire(t, s, "a", Acquired)
+
+	if err := s.Complete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(f.lastCommand(), " "); got != "SET sent:a sent PX 86400000" {
+		t.Errorf("Complete sent %q", got)
+	}
+	acquire(t, s, "a", Sent)
+}
+
+func TestRedisStoreErrorReply(t *testing.T) {
+	f := newFakeRedis(t)
+	s := f.newStore(t, 0)
+
+	err := s.Complete("a")
+	var redisErr redisError
+	if !errors.As(err, &redisErr) || !strings.Contains(err.Error(), "invalid expire time") {
+		t.Fatalf("Complete() = %v, want the server's error reply", err)
+	}
+
+	// An error reply leaves the connection usable.
+	acquire(t, s, "a", Acquired)
+	if n := f.connections(); n != 1 {
+		t.Errorf("opened %d connections, want 1", n)
+	}
+}
+
+func TestRedisStoreReconnects(t *testing.T) {
+	f := newFakeRedis(t)
+	s := f.newStore(t, time.Hour)
+
+	f.mu.Lock()
+	f.drop = true
+	f.mu.Unlock()
+	if _, err := s.Acquire("a"); err == nil {
+		t.Fatal("Acquire() succeeded on a dropped connection")
+	}
+
+	acquire(t, s, "a", Acquired)
+	if n := f.connections(); n != 2 {
+		t.Errorf("opened %d connections, want 2", n)
+	}
+}
+
+func TestReadReply(t *testing.T) {
+	tests := []struct {
+		reply string
+		want  any
+		err   string
+	}{
+		{"+OK\r\n", "OK", ""},
+		{"-ERR wrong type\r\n", nil, "redis: ERR wrong type"},
+		{":42\r\n", int64(42), ""},
+		{"$5\r\nhe\r\nl\r\n", "he\r\nl", ""},
+		{"$0\r\n\r\n", "", ""},
+		{"$-1\r\n", nil, ""},
+		{"*2\r\n$1\r\na\r\n$-1\r\n", []any{"a", nil}, ""},
+		{"?\r\n", nil, `redis: unexpected reply "?"`},
+		{"$5\r\nab", nil, "unexpected EOF"},
+	}
+	for _, tt := range tests {
+		got, err := readReply(bufio.NewReader(strings.NewReader(tt.reply)))
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("readReply(%q) error = %v, want %q", tt.reply, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("readReply(%q) failed: %v", tt.reply, err)
+			continue
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) || fmt.Sprintf("%T", got) != fmt.Sprintf("%T", tt.want) {
+			t.Errorf("readReply(%q) = %#v, want %#v", tt.reply, got, tt.want)
+		}
+	}
+}
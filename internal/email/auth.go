@@ -0,0 +1,136 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"net/smtp"
+	"strings"
+
+	"aptiverse-email/internal/config"
+)
+
+var ErrUnencryptedAuth = errors.New("refusing to send credentials over an unencrypted connection")
+
+// newAuth returns a fresh smtp.Auth for one session, or nil when the
+// configuration does not ask for authentication.
+func (d *smtpDialer) newAuth() smtp.Auth {
+	cfg := d.config
+	switch cfg.AuthMechanism {
+	case config.AuthNone:
+		return nil
+	case config.AuthPlain:
+		return smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	case config.AuthLogin:
+		return &loginAuth{username: cfg.Username, password: cfg.Password, host: cfg.Host}
+	case config.AuthCRAMMD5:
+		return smtp.CRAMMD5Auth(cfg.Username, cfg.Password)
+	case config.AuthXOAUTH2:
+		return &xoauth2Auth{username: cfg.Username, tokens: d.tokens}
+	default:
+		if cfg.Username == "" {
+			return nil
+		}
+		return &autoAuth{config: cfg, tokens: d.tokens}
+	}
+}
+
+// autoAuth picks the strongest mechanism the server advertises that can be
+// used with the configured credentials.
+type autoAuth struct {
+	config config.SMTPConfig
+	tokens TokenSource
+	chosen smtp.Auth
+}
+
+func (a *autoAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	offered := make(map[string]bool)
+	for _, mech := range server.Auth {
+		offered[strings.ToUpper(mech)] = true
+	}
+
+	secure := server.TLS || isLocalhost(server.Name)
+	switch {
+	case a.tokens != nil && offered["XOAUTH2"]:
+		a.chosen = &xoauth2Auth{username: a.config.Username, tokens: a.tokens}
+	case secure && offered["PLAIN"]:
+		a.chosen = smtp.PlainAuth("", a.config.Username, a.config.Password, a.config.Host)
+	case secure && offered["LOGIN"]:
+		a.chosen = &loginAuth{username: a.config.Username, password: a.config.Password, host: a.config.Host}
+	case offered["CRAM-MD5"]:
+		a.chosen = smtp.CRAMMD5Auth(a.config.Username, a.config.Password)
+	case !secure && (offered["PLAIN"] || offered["LOGIN"]):
+		return "", nil, ErrUnencryptedAuth
+	default:
+		return "", nil, fmt.Errorf("no supported smtp auth mechanism offered by server (offered: %s)", strings.Join(server.Auth, " "))
+	}
+
+	return a.chosen.Start(server)
+}
+
+func (a *autoAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	return a.chosen.Next(fromServer, more)
+}
+
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, ErrUnencryptedAuth
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	prompt := strings.ToLower(strings.TrimSpace(string(fromServer)))
+	switch {
+	case strings.HasPrefix(prompt, "user"):
+		return []byte(a.username), nil
+	case strings.HasPrefix(prompt, "pass"):
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected LOGIN challenge %q", fromServer)
+	}
+}
+
+type xoauth2Auth struct {
+	username string
+	tokens   TokenSource
+}
+
+func (a *xoauth2Auth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, ErrUnencryptedAuth
+	}
+	if a.tokens == nil {
+		return "", nil, errors.New("XOAUTH2 requires an OAuth token source")
+	}
+	token, err := a.tokens.Token()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to obtain OAuth access token: %v", err)
+	}
+	resp := "user=" + a.username + "\x01auth=Bearer " + token + "\x01\x01"
+	return "XOAUTH2", []byte(resp), nil
+}
+
+func (a *xoauth2Auth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		// The server sends a JSON error description and expects an empty
+		// response before it fails the exchange.
+		return []byte{}, nil
+	}
+	return nil, nil
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
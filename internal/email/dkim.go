@@ -0,0 +1,264 @@
+package email
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"aptiverse-email/internal/config"
+)
+
+// DKIMSigner adds DKIM-Signature headers (RFC 6376, RFC 8463) to outgoing
+// messages. Every configured key whose domain aligns with the sender domain
+// produces its own signature, so a domain can be signed with both RSA and
+// Ed25519 keys.
+type DKIMSigner struct {
+	keys        []dkimKey
+	headers     []string
+	headerCanon string
+	bodyCanon   string
+}
+
+type dkimKey struct {
+	domain    string
+	selector  string
+	algorithm string
+	signer    crypto.Signer
+}
+
+func NewDKIMSigner(cfg config.DKIMConfig) (*DKIMSigner, error) {
+	headerCanon, bodyCanon, _ := strings.Cut(cfg.Canonicalization, "/")
+	if bodyCanon == "" {
+		bodyCanon = config.DKIMCanonSimple
+	}
+
+	s := &DKIMSigner{
+		headerCanon: headerCanon,
+		bodyCanon:   bodyCanon,
+	}
+	for _, h := range cfg.Headers {
+		s.headers = append(s.headers, strings.ToLower(strings.TrimSpace(h)))
+	}
+
+	for _, k := range cfg.Keys {
+		key, err := loadDKIMKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load DKIM key %s._domainkey.%s: %v", k.Selector, k.Domain, err)
+		}
+		s.keys = append(s.keys, key)
+	}
+	return s, nil
+}
+
+func loadDKIMKey(k config.DKIMKey) (dkimKey, error) {
+	data, err := os.ReadFile(k.PrivateKeyPath)
+	if err != nil {
+		return dkimKey{}, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return dkimKey{}, errors.New("no PEM data found")
+	}
+
+	var parsed any
+	if block.Type == "RSA PRIVATE KEY" {
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return dkimKey{}, err
+	}
+
+	key := dkimKey{domain: strings.ToLower(k.Domain), selector: k.Selector}
+	switch priv := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.algorithm = "rsa-sha256"
+		key.signer = priv
+	case ed25519.PrivateKey:
+		key.algorithm = "ed25519-sha256"
+		key.signer = priv
+	default:
+		return dkimKey{}, fmt.Errorf("unsupported key type %T", parsed)
+	}
+	return key, nil
+}
+
+// Sign returns msg with a DKIM-Signature header prepended for every key that
+// matches the domain of from. Messages from other domains are returned
+// unchanged.
+func (s *DKIMSigner) Sign(from string, msg []byte) ([]byte, error) {
+	domain := strings.ToLower(from[strings.LastIndex(from, "@")+1:])
+
+	var keys []dkimKey
+	for _, key := range s.keys {
+		if domain == key.domain || strings.HasSuffix(domain, "."+key.domain) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return msg, nil
+	}
+
+	header, body := splitMessage(msg)
+	fields := parseHeaderFields(header)
+	bodyHash := sha256.Sum256(canonicalizeBody(body, s.bodyCanon))
+	signedNames, signedFields := s.selectHeaders(fields)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	var signatures bytes.Buffer
+	for _, key := range keys {
+		field := "DKIM-Signature: v=1; a=" + key.algorithm +
+			"; c=" + s.headerCanon + "/" + s.bodyCanon +
+			"; d=" + key.domain + "; s=" + key.selector + ";\r\n" +
+			"\tt=" + timestamp + "; h=" + strings.Join(signedNames, ":") + ";\r\n" +
+			"\tbh=" + base64.StdEncoding.EncodeToString(bodyHash[:]) + ";\r\n" +
+			"\tb="
+
+		h := sha256.New()
+		for _, f := range signedFields {
+			h.Write([]byte(canonicalizeHeader(f, s.headerCanon)))
+		}
+		h.Write([]byte(strings.TrimSuffix(canonicalizeHeader(field+"\r\n", s.headerCanon), "\r\n")))
+		digest := h.Sum(nil)
+
+		var sig []byte
+		var err error
+		if key.algorithm == "ed25519-sha256" {
+			sig, err = key.signer.Sign(rand.Reader, digest, crypto.Hash(0))
+		} else {
+			sig, err = key.signer.Sign(rand.Reader, digest, crypto.SHA256)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign message with DKIM key %s._domainkey.%s: %v", key.selector, key.domain, err)
+		}
+
+		signatures.WriteString(field + base64.StdEncoding.EncodeToString(sig) + "\r\n")
+	}
+
+	return append(signatures.Bytes(), msg...), nil
+}
+
+// selectHeaders returns the names for the h= tag and the matching fields in
+// signing order. Repeated headers are consumed from the bottom up.
+func (s *DKIMSigner) selectHeaders(fields []string) ([]string, []string) {
+	used := make(map[int]bool)
+	var names, selected []string
+	for _, name := range s.headers {
+		for i := len(fields) - 1; i >= 0; i-- {
+			if used[i] || !strings.EqualFold(headerName(fields[i]), name) {
+				continue
+			}
+			used[i] = true
+			names = append(names, name)
+			selected = append(selected, fields[i])
+			break
+		}
+	}
+	return names, selected
+}
+
+func splitMessage(msg []byte) ([]byte, []byte) {
+	if i := bytes.Index(msg, []byte("\r\n\r\n")); i >= 0 {
+		return msg[:i+2], msg[i+4:]
+	}
+	return msg, nil
+}
+
+// parseHeaderFields splits a header block into raw fields, keeping folded
+// continuation lines and the trailing CRLF of each field.
+func parseHeaderFields(header []byte) []string {
+	var fields []string
+	for _, line := range strings.SplitAfter(string(header), "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1] += line
+			continue
+		}
+		fields = append(fields, line)
+	}
+	return fields
+}
+
+func headerName(field string) string {
+	name, _, _ := strings.Cut(field, ":")
+	return strings.TrimSpace(name)
+}
+
+func canonicalizeHeader(field, canon string) string {
+	if canon == config.DKIMCanonSimple {
+		return field
+	}
+
+	name, value, _ := strings.Cut(field, ":")
+	value = strings.ReplaceAll(value, "\r\n", "")
+	value = strings.Join(strings.FieldsFunc(value, isWSP), " ")
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + value + "\r\n"
+}
+
+func canonicalizeBody(body []byte, canon string) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	if canon == config.DKIMCanonRelaxed {
+		for i, line := range lines {
+			lines[i] = strings.Join(strings.FieldsFunc(line, isWSP), " ")
+			if line != "" && isWSP(rune(line[0])) && lines[i] != "" {
+				lines[i] = " " + lines[i]
+			}
+		}
+	}
+
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		if canon == config.DKIMCanonRelaxed {
+			return nil
+		}
+		return []byte("\r\n")
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+func isWSP(r rune) bool {
+	return r == ' ' || r == '\t'
+}
+
+// DKIMTransport signs messages before handing them to the next transport.
+type DKIMTransport struct {
+	next   Transport
+	signer *DKIMSigner
+}
+
+func NewDKIMTransport(next Transport, signer *DKIMSigner) *DKIMTransport {
+	return &DKIMTransport{next: next, signer: signer}
+}
+
+func (t *DKIMTransport) Send(from string, recipients []string, msg []byte) (string, error) {
+	signed, err := t.signer.Sign(from, msg)
+	if err != nil {
+		return "", err
+	}
+	return t.next.Send(from, recipients, signed)
+}
+
+func (t *DKIMTransport) Close() error {
+	if closer, ok := t.next.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
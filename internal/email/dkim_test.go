@@ -0,0 +1,151 @@
+package email
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"aptiverse-email/internal/config"
+	"aptiverse-email/internal/message"
+
+	"github.com/emersion/go-msgauth/dkim"
+)
+
+// testKey writes a private key to disk for NewDKIMSigner and returns its
+// DNS TXT record.
+func testKey(t *testing.T, algorithm string) (string, string) {
+	t.Helper()
+
+	var der, public []byte
+	var keyType string
+	switch algorithm {
+	case "rsa":
+		priv, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		der = x509.MarshalPKCS1PrivateKey(priv)
+		if public, err = x509.MarshalPKIXPublicKey(&priv.PublicKey); err != nil {
+			t.Fatal(err)
+		}
+		keyType = "RSA PRIVATE KEY"
+	case "ed25519":
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if der, err = x509.MarshalPKCS8PrivateKey(priv); err != nil {
+			t.Fatal(err)
+		}
+		public = pub
+		keyType = "PRIVATE KEY"
+	}
+
+	path := filepath.Join(t.TempDir(), algorithm+".pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: keyType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path, fmt.Sprintf("v=DKIM1; k=%s; p=%s", algorithm, base64.StdEncoding.EncodeToString(public))
+}
+
+// testMessage builds a message whose headers are long enough to be folded
+// and whose body is multipart, so signing covers the builder's output.
+func testMessage(t *testing.T) []byte {
+	t.Helper()
+	m := &message.Message{
+		From: mail.Address{Name: "Aptiverse", Address: "no-reply@aptiverse.co.za"},
+		To: []mail.Address{
+			{Name: "Thandiwe Mokoena", Address: "thandiwe@example.com"},
+			{Name: "Sam Naidoo", Address: "sam@example.com"},
+			{Name: "Lerato Dlamini", Address: "lerato@example.com"},
+		},
+		Subject:  "Confirm your email address to finish setting up your Aptiverse account — it only takes a moment",
+		TextBody: "Hello Thandiwe,\n\nConfirm your email:   https://aptiverse.co.za/confirm?token=3f9c  \n\n\n",
+		HTMLBody: "<p>Hello Thandiwe,</p>\n<p><a href='https://aptiverse.co.za/confirm?token=3f9c'>Confirm</a></p>\n",
+	}
+	raw, err := m.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestDKIMSignatureVerifies(t *testing.T) {
+	rsaPath, rsaRecord := testKey(t, "rsa")
+	edPath, edRecord := testKey(t, "ed25519")
+	records := map[string]string{
+		"rsa._domainkey.aptiverse.co.za":     rsaRecord,
+		"ed25519._domainkey.aptiverse.co.za": edRecord,
+	}
+	lookup := func(domain string) ([]string, error) {
+		if record, ok := records[domain]; ok {
+			return []string{record}, nil
+		}
+		return nil, fmt.Errorf("no TXT record for %s", domain)
+	}
+
+	for _, canon := range []string{"simple/simple", "simple/relaxed", "relaxed/simple", "relaxed/relaxed"} {
+		t.Run(canon, func(t *testing.T) {
+			signer, err := NewDKIMSigner(config.DKIMConfig{
+				Keys: []config.DKIMKey{
+					{Domain: "aptiverse.co.za", Selector: "rsa", PrivateKeyPath: rsaPath},
+					{Domain: "aptiverse.co.za", Selector: "ed25519", PrivateKeyPath: edPath},
+				},
+				Headers:          strings.Split("From,Reply-To,Subject,Date,To,Cc,Message-ID,MIME-Version,Content-Type", ","),
+				Canonicalization: canon,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			signed, err := signer.Sign("no-reply@aptiverse.co.za", testMessage(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			verifications, err := dkim.VerifyWithOptions(bytes.NewReader(signed), &dkim.VerifyOptions{LookupTXT: lookup})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(verifications) != 2 {
+				t.Fatalf("got %d signatures, want 2", len(verifications))
+			}
+			for _, v := range verifications {
+				if v.Err != nil {
+					t.Errorf("signature from %s does not verify: %v", v.Domain, v.Err)
+				}
+			}
+		})
+	}
+}
+
+func TestDKIMSkipsOtherDomains(t *testing.T) {
+	path, _ := testKey(t, "ed25519")
+	signer, err := NewDKIMSigner(config.DKIMConfig{
+		Keys:             []config.DKIMKey{{Domain: "aptiverse.co.za", Selector: "ed25519", PrivateKeyPath: path}},
+		Headers:          []string{"From", "Subject"},
+		Canonicalization: "relaxed/relaxed",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := testMessage(t)
+	signed, err := signer.Sign("no-reply@example.com", msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(signed, msg) {
+		t.Errorf("message from another domain was signed")
+	}
+}
@@ -0,0 +1,59 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+)
+
+// SMTPError is a reply from the SMTP server with a failure status code.
+type SMTPError struct {
+	Code    int
+	Message string
+}
+
+func (e *SMTPError) Error() string {
+	return fmt.Sprintf("smtp %03d %s", e.Code, e.Message)
+}
+
+// Temporary reports whether the server asked us to try again later (4xx).
+func (e *SMTPError) Temporary() bool {
+	return e.Code >= 400 && e.Code < 500
+}
+
+// AddressError reports a sender or recipient address that cannot be used.
+type AddressError struct {
+	Field string
+	Err   error
+}
+
+func (e *AddressError) Error() string {
+	return fmt.Sprintf("invalid %s address: %v", e.Field, e.Err)
+}
+
+func (e *AddressError) Unwrap() error {
+	return e.Err
+}
+
+// ConfigError reports a failure caused by the service configuration, such as
+// rejected credentials or a TLS policy the server cannot satisfy. Retrying
+// will not help until the configuration is fixed.
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("configuration error: %v", e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+func wrapSMTPError(err error) error {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return &SMTPError{Code: protoErr.Code, Message: protoErr.Msg}
+	}
+	return err
+}
@@ -0,0 +1,20 @@
+package email
+
+import (
+	"log"
+	"strings"
+)
+
+// LogTransport writes messages to the log instead of delivering them. It is
+// intended for local development.
+type LogTransport struct{}
+
+func NewLogTransport() *LogTransport {
+	return &LogTransport{}
+}
+
+func (t *LogTransport) Send(from string, recipients []string, msg []byte) (string, error) {
+	log.Printf("Log transport: message from %s to %s (%d bytes)\n%s",
+		from, strings.Join(recipients, ", "), len(msg), msg)
+	return "logged", nil
+}
@@ -0,0 +1,90 @@
+package email
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"aptiverse-email/internal/config"
+)
+
+// TokenSource supplies OAuth2 access tokens for XOAUTH2 authentication.
+type TokenSource interface {
+	Token() (string, error)
+}
+
+type StaticTokenSource string
+
+func (s StaticTokenSource) Token() (string, error) {
+	return string(s), nil
+}
+
+// RefreshTokenSource exchanges a long-lived refresh token for access tokens,
+// caching each one until shortly before it expires.
+type RefreshTokenSource struct {
+	config config.OAuthConfig
+	client *http.Client
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+func NewRefreshTokenSource(cfg config.OAuthConfig) *RefreshTokenSource {
+	return &RefreshTokenSource{
+		config: cfg,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (s *RefreshTokenSource) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && time.Now().Before(s.expiry) {
+		return s.token, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {s.config.RefreshToken},
+		"client_id":     {s.config.ClientID},
+		"client_secret": {s.config.ClientSecret},
+	}
+	resp, err := s.client.Post(s.config.TokenURL, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+		Error       string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode token response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || body.AccessToken == "" {
+		return "", fmt.Errorf("token endpoint returned %s: %s", resp.Status, body.Error)
+	}
+
+	s.token = body.AccessToken
+	s.expiry = time.Now().Add(time.Duration(body.ExpiresIn)*time.Second - time.Minute)
+	return s.token, nil
+}
+
+func newTokenSource(cfg config.OAuthConfig) TokenSource {
+	switch {
+	case cfg.RefreshToken != "":
+		return NewRefreshTokenSource(cfg)
+	case cfg.AccessToken != "":
+		return StaticTokenSource(cfg.AccessToken)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,141 @@
+package email
+
+import (
+	"errors"
+	"log"
+	"net/smtp"
+	"sync"
+	"time"
+
+	"aptiverse-email/internal/config"
+)
+
+var ErrPoolClosed = errors.New("smtp pool is closed")
+
+// SMTPPool keeps authenticated SMTP sessions open and reuses them across
+// messages. At most PoolSize sessions are open at any time.
+type SMTPPool struct {
+	config config.SMTPConfig
+	dialer *smtpDialer
+	slots  chan struct{}
+	idle   chan *pooledConn
+
+	mu     sync.Mutex
+	closed bool
+}
+
+type pooledConn struct {
+	client   *smtp.Client
+	messages int
+	lastUsed time.Time
+}
+
+func NewSMTPPool(cfg config.SMTPConfig) (*SMTPPool, error) {
+	dialer, err := newSMTPDialer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &SMTPPool{
+		config: cfg,
+		dialer: dialer,
+		slots:  make(chan struct{}, cfg.PoolSize),
+		idle:   make(chan *pooledConn, cfg.PoolSize),
+	}, nil
+}
+
+func (p *SMTPPool) Send(from string, recipients []string, msg []byte) (string, error) {
+	p.slots <- struct{}{}
+	defer func() { <-p.slots }()
+
+	conn, err := p.get()
+	if err != nil {
+		return "", err
+	}
+
+	response, err := sendMail(conn.client, from, recipients, msg)
+	if err != nil {
+		// A rejected recipient or message leaves the session usable, so
+		// try to reset it rather than paying for a new connection.
+		if resetErr := conn.client.Reset(); resetErr != nil {
+			conn.client.Close()
+		} else {
+			p.put(conn)
+		}
+		return "", wrapSMTPError(err)
+	}
+
+	conn.messages++
+	p.put(conn)
+	return response, nil
+}
+
+func (p *SMTPPool) get() (*pooledConn, error) {
+	for {
+		p.mu.Lock()
+		closed := p.closed
+		p.mu.Unlock()
+		if closed {
+			return nil, ErrPoolClosed
+		}
+
+		select {
+		case conn := <-p.idle:
+			if p.config.PoolIdleTimeout > 0 && time.Since(conn.lastUsed) > p.config.PoolIdleTimeout {
+				conn.client.Quit()
+				continue
+			}
+			if err := conn.client.Noop(); err != nil {
+				log.Printf("Discarding unhealthy SMTP connection: %v", err)
+				conn.client.Close()
+				continue
+			}
+			if err := conn.client.Reset(); err != nil {
+				conn.client.Close()
+				continue
+			}
+			return conn, nil
+		default:
+			client, err := p.dialer.dial()
+			if err != nil {
+				return nil, err
+			}
+			return &pooledConn{client: client}, nil
+		}
+	}
+}
+
+func (p *SMTPPool) put(conn *pooledConn) {
+	if p.config.PoolMaxMessages > 0 && conn.messages >= p.config.PoolMaxMessages {
+		conn.client.Quit()
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		conn.client.Quit()
+		return
+	}
+
+	conn.lastUsed = time.Now()
+	select {
+	case p.idle <- conn:
+	default:
+		conn.client.Quit()
+	}
+}
+
+func (p *SMTPPool) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	for {
+		select {
+		case conn := <-p.idle:
+			conn.client.Quit()
+		default:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package email
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"time"
+
+	"aptiverse-email/internal/config"
+)
+
+const dialTimeout = 30 * time.Second
+
+type SMTPTransport struct {
+	dialer *smtpDialer
+}
+
+func NewSMTPTransport(cfg config.SMTPConfig) (*SMTPTransport, error) {
+	dialer, err := newSMTPDialer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &SMTPTransport{dialer: dialer}, nil
+}
+
+func (t *SMTPTransport) Send(from string, recipients []string, msg []byte) (string, error) {
+	client, err := t.dialer.dial()
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	response, err := sendMail(client, from, recipients, msg)
+	if err != nil {
+		return "", wrapSMTPError(err)
+	}
+	// The message has been accepted, so a failed QUIT is not an error.
+	client.Quit()
+	return response, nil
+}
+
+// smtpDialer opens SMTP sessions and performs the TLS negotiation and
+// authentication required by the configuration.
+type smtpDialer struct {
+	config    config.SMTPConfig
+	tlsConfig *tls.Config
+	tokens    TokenSource
+}
+
+func newSMTPDialer(cfg config.SMTPConfig) (*smtpDialer, error) {
+	tlsCfg, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &smtpDialer{
+		config:    cfg,
+		tlsConfig: tlsCfg,
+		tokens:    newTokenSource(cfg.OAuth),
+	}, nil
+}
+
+func (d *smtpDialer) dial() (*smtp.Client, error) {
+	addr := net.JoinHostPort(d.config.Host, d.config.Port)
+	netDialer := &net.Dialer{Timeout: dialTimeout}
+
+	var conn net.Conn
+	var err error
+	if d.config.TLSMode == config.TLSModeImplicit {
+		conn, err = tls.DialWithDialer(netDialer, "tcp", addr, d.tlsConfig)
+		if isCertificateError(err) {
+			err = &ConfigError{Err: err}
+		}
+	} else {
+		conn, err = netDialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := smtp.NewClient(conn, d.config.Host)
+	if err != nil {
+		conn.Close()
+		return nil, wrapSMTPError(err)
+	}
+
+	if err := client.Hello("localhost"); err != nil {
+		client.Close()
+		return nil, wrapSMTPError(err)
+	}
+
+	if err := d.startTLS(client); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	if err := d.authenticate(client); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+func (d *smtpDialer) startTLS(client *smtp.Client) error {
+	switch d.config.TLSMode {
+	case config.TLSModeNone, config.TLSModeImplicit:
+		return nil
+	}
+
+	if ok, _ := client.Extension("STARTTLS"); !ok {
+		if d.config.TLSMode == config.TLSModeSTARTTLSRequired {
+			return &ConfigError{Err: ErrSTARTTLSNotOffered}
+		}
+		return nil
+	}
+
+	err := client.StartTLS(d.tlsConfig)
+	if isCertificateError(err) {
+		return &ConfigError{Err: err}
+	}
+	return wrapSMTPError(err)
+}
+
+func isCertificateError(err error) bool {
+	var verifyErr *tls.CertificateVerificationError
+	return errors.As(err, &verifyErr)
+}
+
+func (d *smtpDialer) authenticate(client *smtp.Client) error {
+	auth := d.newAuth()
+	if auth == nil {
+		return nil
+	}
+
+	if ok, _ := client.Extension("AUTH"); !ok {
+		// Auto-negotiation keeps the historic behaviour of skipping
+		// authentication on relays that do not offer it.
+		if d.config.AuthMechanism == config.AuthAuto {
+			return nil
+		}
+		return &ConfigError{Err: errors.New("smtp server does not support AUTH")}
+	}
+
+	// Rejected credentials or mechanisms are configuration problems, but a
+	// 4xx reply means the server wants us to retry later.
+	err := wrapSMTPError(client.Auth(auth))
+	var smtpErr *SMTPError
+	if err != nil && !(errors.As(err, &smtpErr) && smtpErr.Temporary()) {
+		return &ConfigError{Err: err}
+	}
+	return err
+}
+
+// sendMail runs one mail transaction and returns the server's reply to the
+// message data. It drives DATA through client.Text because smtp.Client
+// discards that reply, which usually carries the server's queue ID.
+func sendMail(client *smtp.Client, from string, recipients []string, msg []byte) (string, error) {
+	if err := client.Mail(from); err != nil {
+		return "", err
+	}
+	for _, rcpt := range recipients {
+		if err := client.Rcpt(rcpt); err != nil {
+			return "", err
+		}
+	}
+
+	id, err := client.Text.Cmd("DATA")
+	if err != nil {
+		return "", err
+	}
+	client.Text.StartResponse(id)
+	_, _, err = client.Text.ReadResponse(354)
+	client.Text.EndResponse(id)
+	if err != nil {
+		return "", err
+	}
+
+	w := client.Text.DotWriter()
+	if _, err := w.Write(msg); err != nil {
+		w.Close()
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	code, reply, err := client.Text.ReadResponse(250)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d %s", code, reply), nil
+}
@@ -0,0 +1,42 @@
+package email
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"aptiverse-email/internal/config"
+)
+
+var ErrSTARTTLSNotOffered = errors.New("smtp server does not offer STARTTLS but SMTP_TLS_MODE is starttls-required")
+
+func newTLSConfig(cfg config.SMTPConfig) (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		ServerName:         cfg.Host,
+		InsecureSkipVerify: cfg.TLSInsecureSkipVerify,
+	}
+
+	if cfg.TLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", cfg.TLSCAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsCfg, nil
+}
@@ -0,0 +1,43 @@
+package email
+
+import (
+	"fmt"
+
+	"aptiverse-email/internal/config"
+)
+
+// Transport delivers a fully built message to its envelope recipients and
+// returns the server's final reply, if the backend has one.
+type Transport interface {
+	Send(from string, recipients []string, msg []byte) (string, error)
+}
+
+func NewTransport(cfg *config.Config) (Transport, error) {
+	transport, err := newBaseTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cfg.SMTP.DKIM.Keys) > 0 {
+		signer, err := NewDKIMSigner(cfg.SMTP.DKIM)
+		if err != nil {
+			return nil, err
+		}
+		transport = NewDKIMTransport(transport, signer)
+	}
+	return transport, nil
+}
+
+func newBaseTransport(cfg *config.Config) (Transport, error) {
+	switch cfg.Email.Transport {
+	case "smtp":
+		if cfg.SMTP.PoolSize > 0 {
+			return NewSMTPPool(cfg.SMTP)
+		}
+		return NewSMTPTransport(cfg.SMTP)
+	case "log":
+		return NewLogTransport(), nil
+	default:
+		return nil, fmt.Errorf("unknown email transport %q. Available transports: 'smtp', 'log'", cfg.Email.Transport)
+	}
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"aptiverse-email/internal/config"
+	"aptiverse-email/internal/message"
+	"aptiverse-email/internal/models"
+)
+
+var attachmentClient = &http.Client{Timeout: 30 * time.Second}
+
+func loadAttachments(attachments []models.Attachment, cfg *config.Config) ([]message.Attachment, error) {
+	loaded := make([]message.Attachment, 0, len(attachments))
+	for _, a := range attachments {
+		data, err := loadAttachmentData(a, cfg.Email)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load attachment %q: %w", a.Filename, err)
+		}
+
+		contentID := a.ContentID
+		if a.Inline && contentID == "" {
+			contentID = a.Filename
+		}
+
+		loaded = append(loaded, message.Attachment{
+			Filename:    a.Filename,
+			ContentType: a.ContentType,
+			Data:        data,
+			Inline:      a.Inline,
+			ContentID:   contentID,
+		})
+	}
+	return loaded, nil
+}
+
+func loadAttachmentData(a models.Attachment, cfg config.EmailConfig) ([]byte, error) {
+	switch {
+	case a.Content != "":
+		data, err := base64.StdEncoding.DecodeString(a.Content)
+		if err != nil {
+			return nil, &ValidationError{Err: fmt.Errorf("invalid base64 content: %v", err)}
+		}
+		if int64(len(data)) > cfg.AttachmentMaxBytes {
+			return nil, &ValidationError{Err: fmt.Errorf("attachment exceeds %d bytes", cfg.AttachmentMaxBytes)}
+		}
+		return data, nil
+	case a.URL != "":
+		return fetchAttachment(a.URL, cfg)
+	case a.Path != "":
+		return readAttachment(a.Path, cfg)
+	default:
+		return nil, &ValidationError{Err: errors.New("attachment has no content, url or path")}
+	}
+}
+
+func fetchAttachment(rawURL string, cfg config.EmailConfig) ([]byte, error) {
+	if len(cfg.AttachmentURLPrefixes) == 0 {
+		return nil, &ValidationError{Err: errors.New("attachment urls are disabled because ATTACHMENT_URL_PREFIXES is not set")}
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || !urlAllowed(u, cfg.AttachmentURLPrefixes) {
+		return nil, &ValidationError{Err: fmt.Errorf("attachment url %q is not under ATTACHMENT_URL_PREFIXES", rawURL)}
+	}
+
+	// Redirects are held to the same prefixes, so an allowed host cannot
+	// bounce the request to an internal one.
+	client := *attachmentClient
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		if !urlAllowed(req.URL, cfg.AttachmentURLPrefixes) {
+			return &ValidationError{Err: fmt.Errorf("attachment url %q redirected to %q, which is not under ATTACHMENT_URL_PREFIXES", rawURL, req.URL)}
+		}
+		return nil
+	}
+
+	resp, err := client.Get(u.String())
+	if err != nil {
+		var validationErr *ValidationError
+		if errors.As(err, &validationErr) {
+			return nil, validationErr
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("fetching %s returned %s", rawURL, resp.Status)
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+			return nil, &ValidationError{Err: err}
+		}
+		return nil, err
+	}
+	return readLimited(resp.Body, cfg.AttachmentMaxBytes)
+}
+
+// urlAllowed reports whether u has the scheme and host of one of prefixes
+// and a path under its path. Paths with ".." segments are never allowed.
+func urlAllowed(u *url.URL, prefixes []string) bool {
+	if u.User != nil || strings.Contains("/"+u.Path+"/", "/../") {
+		return false
+	}
+	for _, prefix := range prefixes {
+		p, err := url.Parse(prefix)
+		if err != nil {
+			continue
+		}
+		if !strings.EqualFold(u.Scheme, p.Scheme) || !strings.EqualFold(u.Host, p.Host) {
+			continue
+		}
+		if p.Path == "" || strings.HasSuffix(p.Path, "/") {
+			if strings.HasPrefix(u.Path, p.Path) {
+				return true
+			}
+		} else if u.Path == p.Path || strings.HasPrefix(u.Path, p.Path+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// readAttachment reads a file from the configured attachment directory.
+// Paths are resolved relative to that directory and may not escape it.
+func readAttachment(path string, cfg config.EmailConfig) ([]byte, error) {
+	if cfg.AttachmentDir == "" {
+		return nil, &ValidationError{Err: errors.New("attachment paths are disabled because ATTACHMENT_DIR is not set")}
+	}
+
+	full := filepath.Join(cfg.AttachmentDir, filepath.Clean("/"+path))
+	rel, err := filepath.Rel(cfg.AttachmentDir, full)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return nil, &ValidationError{Err: fmt.Errorf("attachment path %q is outside ATTACHMENT_DIR", path)}
+	}
+
+	f, err := os.Open(full)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, &ValidationError{Err: err}
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readLimited(f, cfg.AttachmentMaxBytes)
+}
+
+func readLimited(r io.Reader, maxBytes int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, &ValidationError{Err: fmt.Errorf("attachment exceeds %d bytes", maxBytes)}
+	}
+	return data, nil
+}
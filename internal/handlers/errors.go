@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"aptiverse-email/internal/email"
+)
+
+// TemplateError reports a template that is unknown or failed to render.
+type TemplateError struct {
+	Template string
+	Err      error
+}
+
+func (e *TemplateError) Error() string {
+	return fmt.Sprintf("template %q: %v", e.Template, e.Err)
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError reports an email request that can never be sent as given.
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid email request: %v", e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ExpiredError reports a message that became too old to be worth sending.
+type ExpiredError struct {
+	Deadline time.Time
+}
+
+func (e *ExpiredError) Error() string {
+	return fmt.Sprintf("email expired at %s", e.Deadline.Format(time.RFC3339))
+}
+
+type ErrorClass int
+
+const (
+	// Transient failures may succeed if the message is retried later.
+	Transient ErrorClass = iota
+	// Permanent failures will fail the same way on every attempt.
+	Permanent
+	// Misconfigured failures need an operator to fix the service configuration.
+	Misconfigured
+	// Expired messages are past their deadline and must not be sent.
+	Expired
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case Permanent:
+		return "permanent"
+	case Misconfigured:
+		return "config"
+	case Expired:
+		return "expired"
+	default:
+		return "transient"
+	}
+}
+
+// Classify decides how a failure returned by HandleEmailMessage should be
+// treated. Unrecognised errors, such as network failures, are transient.
+func Classify(err error) ErrorClass {
+	var expiredErr *ExpiredError
+	if errors.As(err, &expiredErr) {
+		return Expired
+	}
+
+	var configErr *email.ConfigError
+	if errors.As(err, &configErr) {
+		return Misconfigured
+	}
+
+	var smtpErr *email.SMTPError
+	if errors.As(err, &smtpErr) {
+		if smtpErr.Temporary() {
+			return Transient
+		}
+		return Permanent
+	}
+
+	var addrErr *email.AddressError
+	var templateErr *TemplateError
+	var validationErr *ValidationError
+	if errors.As(err, &addrErr) || errors.As(err, &templateErr) || errors.As(err, &validationErr) {
+		return Permanent
+	}
+
+	return Transient
+}
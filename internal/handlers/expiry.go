@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"time"
+
+	"aptiverse-email/internal/config"
+	"aptiverse-email/internal/models"
+)
+
+// CheckExpiry returns an ExpiredError if emailReq is past its expiresAt or
+// older than the max age for its template. Age is measured from sendAt for
+// scheduled emails and from the request timestamp otherwise.
+func CheckExpiry(emailReq *models.EmailRequest, cfg *config.Config, now time.Time) error {
+	if emailReq.ExpiresAt != nil && !now.Before(*emailReq.ExpiresAt) {
+		return &ExpiredError{Deadline: *emailReq.ExpiresAt}
+	}
+
+	maxAge, ok := cfg.Email.TemplateMaxAge[emailReq.TemplateType]
+	if !ok {
+		maxAge = cfg.Email.MaxAge
+	}
+	if maxAge <= 0 {
+		return nil
+	}
+
+	queuedAt := emailReq.Timestamp
+	if emailReq.SendAt != nil && emailReq.SendAt.After(queuedAt) {
+		queuedAt = *emailReq.SendAt
+	}
+	if queuedAt.IsZero() {
+		return nil
+	}
+
+	if deadline := queuedAt.Add(maxAge); !now.Before(deadline) {
+		return &ExpiredError{Deadline: deadline}
+	}
+	return nil
+}
@@ -1,43 +1,141 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"net/mail"
+	"strings"
 
+	"aptiverse-email/internal/config"
 	"aptiverse-email/internal/email"
+	"aptiverse-email/internal/message"
 	"aptiverse-email/internal/models"
 	"aptiverse-email/internal/templates"
 )
 
-func HandleEmailMessage(emailReq *models.EmailRequest, emailSvc *email.Sender) error {
+func HandleEmailMessage(emailReq *models.EmailRequest, transport email.Transport, cfg *config.Config) (string, error) {
 	log.Printf("Processing email for: %s", emailReq.To)
-	
-	var htmlBody string
-	var err error
-	
-	switch emailReq.TemplateType {
-	case "email_confirmation":
-		templateData := templates.EmailTemplateData{
-			FirstName:        emailReq.FirstName,
-			LastName:         emailReq.LastName,
-			UserName:         emailReq.UserName,
-			Email:            emailReq.Email,
-			UserType:         emailReq.UserType,
-			ConfirmationLink: emailReq.ConfirmationLink,
-		}
-		htmlBody, err = templates.GenerateEmailConfirmationTemplate(templateData)
-		if err != nil {
-			return fmt.Errorf("failed to generate email template: %v", err)
+
+	tmpl, ok := templates.Lookup(emailReq.TemplateType)
+	if !ok {
+		return "", &TemplateError{Template: emailReq.TemplateType, Err: fmt.Errorf("unknown template type for email to %s. Available types: '%s'", emailReq.To, strings.Join(templates.Names(), "', '"))}
+	}
+
+	rendered, err := tmpl.Render(templateData(emailReq), templates.RenderOptions{
+		Locale:  emailReq.Locale,
+		Subject: emailReq.Subject,
+	})
+	if err != nil {
+		var missing *templates.MissingFieldsError
+		var schemaErr *templates.SchemaError
+		if errors.As(err, &missing) || errors.As(err, &schemaErr) {
+			return "", &ValidationError{Err: err}
 		}
-		log.Printf("Generated email confirmation template for %s", emailReq.To)
-	default:
-		return fmt.Errorf("no template type specified for email to %s. Available types: 'email_confirmation'", emailReq.To)
+		return "", &TemplateError{Template: emailReq.TemplateType, Err: fmt.Errorf("failed to render template: %w", err)}
+	}
+	log.Printf("Rendered %s template for %s", tmpl.Name, emailReq.To)
+
+	from, err := mail.ParseAddress(cfg.SMTP.From)
+	if err != nil {
+		return "", &email.ConfigError{Err: &email.AddressError{Field: "from", Err: err}}
+	}
+	to, err := parseRecipients("to", emailReq.To)
+	if err != nil {
+		return "", err
+	}
+	cc, err := parseRecipients("cc", emailReq.Cc)
+	if err != nil {
+		return "", err
+	}
+	bcc, err := parseRecipients("bcc", emailReq.Bcc)
+	if err != nil {
+		return "", err
+	}
+	replyTo, err := parseRecipients("reply-to", emailReq.ReplyTo)
+	if err != nil {
+		return "", err
+	}
+	legacyReplyTo, err := parseRecipients("reply-to", emailReq.LegacyReplyTo)
+	if err != nil {
+		return "", err
+	}
+	replyTo = append(replyTo, legacyReplyTo...)
+	if len(to)+len(cc)+len(bcc) == 0 {
+		return "", &ValidationError{Err: errors.New("no recipients specified")}
+	}
+
+	attachments, err := loadAttachments(emailReq.Attachments, cfg)
+	if err != nil {
+		return "", err
+	}
+
+	msg := &message.Message{
+		From:        *from,
+		To:          to,
+		Cc:          cc,
+		Bcc:         bcc,
+		ReplyTo:     replyTo,
+		Subject:     rendered.Subject,
+		HTMLBody:    rendered.HTML,
+		TextBody:    rendered.Text,
+		Attachments: attachments,
 	}
-	
-	if err := emailSvc.Send(emailReq.To, emailReq.Subject, htmlBody); err != nil {
-		return fmt.Errorf("failed to send email: %v", err)
+
+	response, err := email.Send(transport, msg)
+	if err != nil {
+		return "", fmt.Errorf("failed to send email: %w", err)
 	}
-	
+
 	log.Printf("Successfully processed email for %s", emailReq.To)
-	return nil
-}
\ No newline at end of file
+	return response, nil
+}
+
+// templateData combines the request's data with its legacy top-level
+// fields. Values in data win over legacy fields of the same name.
+func templateData(emailReq *models.EmailRequest) map[string]any {
+	data := make(map[string]any, len(emailReq.Data)+6)
+	for key, value := range emailReq.Data {
+		data[key] = value
+	}
+
+	legacy := map[string]string{
+		"firstName":        emailReq.FirstName,
+		"lastName":         emailReq.LastName,
+		"userName":         emailReq.UserName,
+		"email":            emailReq.Email,
+		"userType":         emailReq.UserType,
+		"confirmationLink": emailReq.ConfirmationLink,
+	}
+	for key, value := range legacy {
+		if _, ok := data[key]; !ok && value != "" {
+			data[key] = value
+		}
+	}
+	return data
+}
+
+// parseRecipients validates each recipient. Entries without a separate name
+// may use the "Name <address>" form or hold a comma separated list.
+func parseRecipients(field string, recipients models.Recipients) ([]mail.Address, error) {
+	var addrs []mail.Address
+	for _, r := range recipients {
+		if r.Name != "" {
+			addr, err := mail.ParseAddress(r.Email)
+			if err != nil {
+				return nil, &email.AddressError{Field: field, Err: err}
+			}
+			addrs = append(addrs, mail.Address{Name: r.Name, Address: addr.Address})
+			continue
+		}
+
+		list, err := mail.ParseAddressList(r.Email)
+		if err != nil {
+			return nil, &email.AddressError{Field: field, Err: err}
+		}
+		for _, addr := range list {
+			addrs = append(addrs, *addr)
+		}
+	}
+	return addrs, nil
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/mail"
+	"testing"
+
+	"aptiverse-email/internal/config"
+	"aptiverse-email/internal/models"
+	"aptiverse-email/internal/templates"
+)
+
+// captureTransport keeps the last message it was asked to send.
+type captureTransport struct {
+	recipients []string
+	msg        []byte
+}
+
+func (t *captureTransport) Send(from string, recipients []string, msg []byte) (string, error) {
+	t.recipients, t.msg = recipients, msg
+	return "250 OK", nil
+}
+
+func handle(t *testing.T, payload string) (*captureTransport, error) {
+	t.Helper()
+	var req models.EmailRequest
+	if err := json.Unmarshal([]byte(payload), &req); err != nil {
+		t.Fatal(err)
+	}
+	transport := &captureTransport{}
+	_, err := HandleEmailMessage(&req, transport, &config.Config{SMTP: config.SMTPConfig{From: "no-reply@aptiverse.co.za"}})
+	return transport, err
+}
+
+// confirmation is a valid email_confirmation request missing its closing brace.
+const confirmation = `{"to": "ann@example.com", "templateType": "email_confirmation", "firstName": "Ann", "confirmationLink": "https://aptiverse.co.za/confirm?token=1"`
+
+func TestReplyToAcceptsLegacyField(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields string
+		want   string
+	}{
+		{"replyTo", `"replyTo": "Support <support@example.com>"`, `"Support" <support@example.com>`},
+		{"reply_to", `"reply_to": "Support <support@example.com>"`, `"Support" <support@example.com>`},
+		{"both", `"replyTo": "support@example.com", "reply_to": ["billing@example.com"]`, `<support@example.com>, <billing@example.com>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport, err := handle(t, confirmation+", "+tt.fields+"}")
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg, err := mail.ReadMessage(bytes.NewReader(transport.msg))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := msg.Header.Get("Reply-To"); got != tt.want {
+				t.Errorf("Reply-To = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchemaMismatchIsPermanent(t *testing.T) {
+	tests := map[string]string{
+		"format": `{"to": "ann@example.com", "templateType": "email_confirmation", "firstName": "Ann", "confirmationLink": "not a link"}`,
+		"type":   `{"to": "ann@example.com", "templateType": "email_confirmation", "data": {"firstName": 5, "confirmationLink": "https://aptiverse.co.za/confirm"}}`,
+	}
+	for name, payload := range tests {
+		t.Run(name, func(t *testing.T) {
+			transport, err := handle(t, payload)
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("HandleEmailMessage() = %v, want a ValidationError", err)
+			}
+			var schemaErr *templates.SchemaError
+			if !errors.As(err, &schemaErr) {
+				t.Errorf("HandleEmailMessage() = %v, want it to wrap the SchemaError", err)
+			}
+			if class := Classify(err); class != Permanent {
+				t.Errorf("Classify() = %s, want permanent", class)
+			}
+			if transport.msg != nil {
+				t.Error("an email that breaks its schema was sent")
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package message
+
+import (
+	"bytes"
+	"encoding/base64"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxLineLength is the preferred header line length from RFC 5322.
+	maxLineLength = 78
+	// maxHeaderLineLength is the hard limit on a header line from RFC 5322,
+	// not counting the CRLF.
+	maxHeaderLineLength = 998
+	// encodedWordBytes is how much of a token goes in one RFC 2047
+	// encoded-word, short enough for the word to follow a header name on
+	// the first line.
+	encodedWordBytes = 39
+	// base64LineLength keeps encoded lines well under the 998 character limit.
+	base64LineLength = 76
+)
+
+// writeHeader writes a header field, folding it before existing whitespace
+// so that lines stay within the recommended length and unfold to exactly
+// the original value. Tokens too long for any line are written as RFC 2047
+// encoded-words, which can be folded between.
+func writeHeader(w *bytes.Buffer, name, value string) {
+	line := name + ":"
+	for _, segment := range foldSegments(" "+value, maxHeaderLineLength-len(name)-2) {
+		if len(line)+len(segment) > maxLineLength && line != name+":" {
+			w.WriteString(line + "\r\n")
+			line = ""
+		}
+		line += segment
+	}
+	w.WriteString(line + "\r\n")
+}
+
+// foldSegments splits value before each run of whitespace, keeping the run
+// with the token after it. Tokens longer than maxToken are encoded.
+func foldSegments(value string, maxToken int) []string {
+	var segments []string
+	start := 0
+	for i := 1; i <= len(value); i++ {
+		if i < len(value) && (!isWSP(value[i]) || isWSP(value[i-1])) {
+			continue
+		}
+		segment := value[start:i]
+		start = i
+
+		token := strings.TrimLeft(segment, " \t")
+		if len(token) <= maxToken {
+			segments = append(segments, segment)
+			continue
+		}
+		space := segment[:len(segment)-len(token)]
+		for _, word := range encodeToken(token) {
+			segments = append(segments, space+word)
+			space = " "
+		}
+	}
+	return segments
+}
+
+// encodeToken splits token into base64 encoded-words, breaking only at
+// UTF-8 character boundaries.
+func encodeToken(token string) []string {
+	var words []string
+	for token != "" {
+		n := min(len(token), encodedWordBytes)
+		for n < len(token) && !utf8.RuneStart(token[n]) {
+			n--
+		}
+		words = append(words, "=?utf-8?b?"+base64.StdEncoding.EncodeToString([]byte(token[:n]))+"?=")
+		token = token[n:]
+	}
+	return words
+}
+
+func isWSP(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+func formatAddressList(addrs []mail.Address) string {
+	formatted := make([]string, len(addrs))
+	for i := range addrs {
+		formatted[i] = addrs[i].String()
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// chooseEncoding prefers quoted-printable, which keeps mostly-ASCII content
+// readable, and falls back to base64 for content that is largely non-ASCII
+// or not valid UTF-8.
+func chooseEncoding(content []byte) string {
+	if !utf8.Valid(content) {
+		return "base64"
+	}
+	nonASCII := 0
+	for _, b := range content {
+		if b >= 0x80 {
+			nonASCII++
+		}
+	}
+	if nonASCII*3 > len(content) {
+		return "base64"
+	}
+	return "quoted-printable"
+}
+
+func encode(w *bytes.Buffer, encoding string, content []byte) error {
+	switch encoding {
+	case "base64":
+		encoded := base64.StdEncoding.EncodeToString(content)
+		for len(encoded) > base64LineLength {
+			w.WriteString(encoded[:base64LineLength] + "\r\n")
+			encoded = encoded[base64LineLength:]
+		}
+		if encoded != "" {
+			w.WriteString(encoded + "\r\n")
+		}
+		return nil
+	case "quoted-printable":
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write(content); err != nil {
+			return err
+		}
+		if err := qp.Close(); err != nil {
+			return err
+		}
+		w.WriteString("\r\n")
+		return nil
+	default:
+		w.Write(content)
+		return nil
+	}
+}
@@ -0,0 +1,306 @@
+package message
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Message is an email ready to be rendered as an RFC 5322 / RFC 2045
+// compliant byte stream.
+type Message struct {
+	From      mail.Address
+	To        []mail.Address
+	Cc        []mail.Address
+	Bcc       []mail.Address
+	ReplyTo   []mail.Address
+	Subject   string
+	Date      time.Time
+	MessageID string
+	HTMLBody  string
+	TextBody  string
+
+	Attachments []Attachment
+}
+
+// Attachment is a file carried by the message. Inline attachments are
+// placed in a multipart/related part so the HTML body can reference them
+// with cid: URLs.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+	Inline      bool
+	ContentID   string
+}
+
+// Recipients returns the bare envelope addresses of every To, Cc and Bcc
+// recipient, without duplicates. Bcc addresses only ever appear here, never
+// in the message headers.
+func (m *Message) Recipients() []string {
+	seen := make(map[string]bool)
+	var recipients []string
+	for _, list := range [][]mail.Address{m.To, m.Cc, m.Bcc} {
+		for _, addr := range list {
+			key := strings.ToLower(addr.Address)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			recipients = append(recipients, addr.Address)
+		}
+	}
+	return recipients
+}
+
+func (m *Message) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (m *Message) WriteTo(w io.Writer) (int64, error) {
+	if m.From.Address == "" {
+		return 0, errors.New("message has no from address")
+	}
+	if len(m.To)+len(m.Cc)+len(m.Bcc) == 0 {
+		return 0, errors.New("message has no recipients")
+	}
+	if m.HTMLBody == "" && m.TextBody == "" {
+		return 0, errors.New("message has no body")
+	}
+
+	date := m.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	messageID := m.MessageID
+	if messageID == "" {
+		messageID = newMessageID(m.From.Address)
+	}
+
+	root := m.bodyPart()
+
+	var buf bytes.Buffer
+	writeHeader(&buf, "Date", date.Format(time.RFC1123Z))
+	writeHeader(&buf, "From", m.From.String())
+	if len(m.To) > 0 {
+		writeHeader(&buf, "To", formatAddressList(m.To))
+	} else {
+		writeHeader(&buf, "To", "undisclosed-recipients:;")
+	}
+	if len(m.Cc) > 0 {
+		writeHeader(&buf, "Cc", formatAddressList(m.Cc))
+	}
+	if len(m.ReplyTo) > 0 {
+		writeHeader(&buf, "Reply-To", formatAddressList(m.ReplyTo))
+	}
+	writeHeader(&buf, "Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	writeHeader(&buf, "Message-ID", messageID)
+	writeHeader(&buf, "MIME-Version", "1.0")
+	if err := root.writeTo(&buf, true); err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
+
+func (m *Message) bodyPart() *part {
+	var text, html *part
+	if m.TextBody != "" {
+		text = newTextPart("text/plain", m.TextBody)
+	}
+	if m.HTMLBody != "" {
+		html = newTextPart("text/html", m.HTMLBody)
+	}
+
+	var body *part
+	switch {
+	case text != nil && html != nil:
+		body = newMultipart("alternative", text, html)
+	case html != nil:
+		body = html
+	default:
+		body = text
+	}
+
+	var inline, attached []*part
+	for i := range m.Attachments {
+		if m.Attachments[i].Inline {
+			inline = append(inline, newAttachmentPart(&m.Attachments[i]))
+		} else {
+			attached = append(attached, newAttachmentPart(&m.Attachments[i]))
+		}
+	}
+
+	if len(inline) > 0 {
+		related := newMultipart("related", append([]*part{body}, inline...)...)
+		related.params["type"] = body.contentType
+		body = related
+	}
+	if len(attached) > 0 {
+		body = newMultipart("mixed", append([]*part{body}, attached...)...)
+	}
+	return body
+}
+
+// part is a node of the MIME tree. Leaf parts carry content, multipart
+// nodes carry children.
+type part struct {
+	contentType string
+	params      map[string]string
+	header      textproto.MIMEHeader
+	content     []byte
+	encoding    string
+	children    []*part
+}
+
+func newTextPart(contentType, body string) *part {
+	content := []byte(body)
+	return &part{
+		contentType: contentType,
+		params:      map[string]string{"charset": "UTF-8"},
+		content:     content,
+		encoding:    chooseEncoding(content),
+	}
+}
+
+func newAttachmentPart(a *Attachment) *part {
+	contentType := a.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(a.Filename))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = "application/octet-stream", map[string]string{}
+	}
+	if a.Filename != "" {
+		params["name"] = a.Filename
+	}
+
+	disposition := "attachment"
+	if a.Inline {
+		disposition = "inline"
+	}
+	dispositionParams := map[string]string{}
+	if a.Filename != "" {
+		dispositionParams["filename"] = a.Filename
+	}
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", mime.FormatMediaType(disposition, dispositionParams))
+	if a.ContentID != "" {
+		header.Set("Content-ID", "<"+strings.Trim(a.ContentID, "<>")+">")
+	}
+
+	return &part{
+		contentType: mediaType,
+		params:      params,
+		header:      header,
+		content:     a.Data,
+		encoding:    "base64",
+	}
+}
+
+func newMultipart(subtype string, children ...*part) *part {
+	return &part{
+		contentType: "multipart/" + subtype,
+		params:      map[string]string{},
+		children:    children,
+	}
+}
+
+// writeTo writes the part's MIME headers followed by its body. Top-level
+// parts write their headers in a fixed order so the message header block
+// stays deterministic.
+func (p *part) writeTo(w *bytes.Buffer, topLevel bool) error {
+	header := p.mimeHeader()
+
+	if topLevel {
+		for _, key := range []string{"Content-Type", "Content-Transfer-Encoding", "Content-Disposition", "Content-ID"} {
+			if value := header.Get(key); value != "" {
+				writeHeader(w, key, value)
+			}
+		}
+		w.WriteString("\r\n")
+	}
+
+	return p.writeBody(w)
+}
+
+func (p *part) mimeHeader() textproto.MIMEHeader {
+	header := make(textproto.MIMEHeader)
+	for k, v := range p.header {
+		header[k] = v
+	}
+	if len(p.children) > 0 && p.params["boundary"] == "" {
+		p.params["boundary"] = newBoundary()
+	}
+	header.Set("Content-Type", mime.FormatMediaType(p.contentType, p.params))
+	if p.encoding != "" {
+		header.Set("Content-Transfer-Encoding", p.encoding)
+	}
+	return header
+}
+
+func (p *part) writeBody(w *bytes.Buffer) error {
+	if len(p.children) == 0 {
+		return encode(w, p.encoding, p.content)
+	}
+
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(p.params["boundary"]); err != nil {
+		return err
+	}
+	for _, child := range p.children {
+		pw, err := mw.CreatePart(child.mimeHeader())
+		if err != nil {
+			return err
+		}
+		var body bytes.Buffer
+		if err := child.writeBody(&body); err != nil {
+			return err
+		}
+		if _, err := pw.Write(body.Bytes()); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+func newBoundary() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return "aptiverse-" + hex.EncodeToString(b[:])
+}
+
+func newMessageID(from string) string {
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = from[at+1:]
+	}
+
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(b[:]), domain)
+}
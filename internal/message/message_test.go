@@ -0,0 +1,212 @@
+package message
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+// node is a parsed MIME part: its media type, decoded body and children.
+type node struct {
+	mediaType string
+	header    mail.Header
+	body      string
+	children  []*node
+}
+
+func parseNode(t *testing.T, header mail.Header, body io.Reader) *node {
+	t.Helper()
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("bad Content-Type %q: %v", header.Get("Content-Type"), err)
+	}
+	n := &node{mediaType: mediaType, header: header}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextRawPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("reading %s: %v", mediaType, err)
+			}
+			n.children = append(n.children, parseNode(t, mail.Header(p.Header), p))
+		}
+		return n
+	}
+
+	switch header.Get("Content-Transfer-Encoding") {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		data, err := io.ReadAll(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(data), "\r\n", ""))
+		if err != nil {
+			t.Fatalf("decoding %s: %v", mediaType, err)
+		}
+		n.body = string(decoded)
+		return n
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The encoder ends every leaf with a line break of its own.
+	n.body = strings.TrimSuffix(string(data), "\r\n")
+	return n
+}
+
+func parseMessage(t *testing.T, m *Message) (*mail.Message, *node) {
+	t.Helper()
+	raw, err := m.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("message does not parse: %v\n%s", err, raw)
+	}
+	return msg, parseNode(t, msg.Header, msg.Body)
+}
+
+func TestMessageTree(t *testing.T) {
+	m := &Message{
+		From:     mail.Address{Name: "Aptiverse", Address: "no-reply@aptiverse.co.za"},
+		To:       []mail.Address{{Address: "ann@example.com"}},
+		Subject:  "Welcome",
+		TextBody: "Hello Ann",
+		HTMLBody: `<p>Hello Ann <img src="cid:logo"></p>`,
+		Attachments: []Attachment{
+			{Filename: "logo.png", ContentType: "image/png", Data: []byte("\x89PNG"), Inline: true, ContentID: "logo"},
+			{Filename: "terms.pdf", Data: []byte("%PDF-1.4")},
+		},
+	}
+	_, root := parseMessage(t, m)
+
+	if root.mediaType != "multipart/mixed" || len(root.children) != 2 {
+		t.Fatalf("root is %s with %d parts, want multipart/mixed with 2", root.mediaType, len(root.children))
+	}
+	related, attachment := root.children[0], root.children[1]
+	if related.mediaType != "multipart/related" || len(related.children) != 2 {
+		t.Fatalf("first part is %s with %d parts, want multipart/related with 2", related.mediaType, len(related.children))
+	}
+	alternative, inline := related.children[0], related.children[1]
+	if alternative.mediaType != "multipart/alternative" || len(alternative.children) != 2 {
+		t.Fatalf("related body is %s with %d parts, want multipart/alternative with 2", alternative.mediaType, len(alternative.children))
+	}
+
+	text, html := alternative.children[0], alternative.children[1]
+	if text.mediaType != "text/plain" || text.body != "Hello Ann" {
+		t.Errorf("text part is %s %q", text.mediaType, text.body)
+	}
+	if html.mediaType != "text/html" || html.body != m.HTMLBody {
+		t.Errorf("html part is %s %q", html.mediaType, html.body)
+	}
+	if inline.mediaType != "image/png" || inline.body != "\x89PNG" || inline.header.Get("Content-ID") != "<logo>" {
+		t.Errorf("inline part is %s %q with Content-ID %q", inline.mediaType, inline.body, inline.header.Get("Content-ID"))
+	}
+	if attachment.mediaType != "application/pdf" || attachment.body != "%PDF-1.4" {
+		t.Errorf("attachment is %s %q", attachment.mediaType, attachment.body)
+	}
+	if _, params, _ := mime.ParseMediaType(attachment.header.Get("Content-Disposition")); params["filename"] != "terms.pdf" {
+		t.Errorf("attachment disposition is %q", attachment.header.Get("Content-Disposition"))
+	}
+}
+
+func TestMessageOmitsBcc(t *testing.T) {
+	m := &Message{
+		From:     mail.Address{Address: "no-reply@aptiverse.co.za"},
+		To:       []mail.Address{{Address: "ann@example.com"}},
+		Bcc:      []mail.Address{{Name: "Audit", Address: "audit@example.com"}},
+		Subject:  "Welcome",
+		TextBody: "Hello",
+	}
+	raw, err := m.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(bytes.ToLower(raw), []byte("bcc")) || bytes.Contains(raw, []byte("audit@example.com")) {
+		t.Errorf("Bcc leaked into the message:\n%s", raw)
+	}
+	if got := m.Recipients(); len(got) != 2 || got[1] != "audit@example.com" {
+		t.Errorf("Recipients() = %v, want the Bcc address included", got)
+	}
+
+	m.To = nil
+	msg, _ := parseMessage(t, m)
+	if to := msg.Header.Get("To"); to != "undisclosed-recipients:;" {
+		t.Errorf("To for a Bcc-only message is %q", to)
+	}
+}
+
+func TestSubjectCannotInjectHeaders(t *testing.T) {
+	m := &Message{
+		From:     mail.Address{Address: "no-reply@aptiverse.co.za"},
+		To:       []mail.Address{{Address: "ann@example.com"}},
+		Subject:  "Hello\r\nBcc: victim@example.com\r\n\r\nInjected body",
+		TextBody: "Hello",
+	}
+	msg, root := parseMessage(t, m)
+
+	if bcc := msg.Header.Get("Bcc"); bcc != "" {
+		t.Errorf("subject injected a Bcc header: %q", bcc)
+	}
+	if root.body != "Hello" {
+		t.Errorf("subject injected into the body: %q", root.body)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(subject, "Hello") || !strings.Contains(subject, "victim@example.com") {
+		t.Errorf("subject decoded to %q", subject)
+	}
+}
+
+func TestWriteHeaderFolding(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"spaces are kept", "Order  #12\tshipped"},
+		{"long value", strings.Repeat("Your order  has shipped, ", 10)},
+		{"overlong token", "Token: " + strings.Repeat("x", 2000) + " end"},
+		{"overlong non-ASCII token", strings.Repeat("é", 600)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			writeHeader(&buf, "Subject", tt.value)
+
+			lines := strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n")
+			for i, line := range lines {
+				if len(line) > maxLineLength {
+					t.Errorf("line %d has %d characters", i, len(line))
+				}
+				if i > 0 && !isWSP(line[0]) {
+					t.Errorf("continuation line %d does not start with whitespace: %q", i, line)
+				}
+			}
+
+			unfolded := strings.TrimPrefix(strings.Join(lines, ""), "Subject: ")
+			decoded, err := new(mime.WordDecoder).DecodeHeader(unfolded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded != tt.value {
+				t.Errorf("header unfolds to %q, want %q", decoded, tt.value)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+const (
+	EventSent     = "email.sent"
+	EventFailed   = "email.failed"
+	EventRetrying = "email.retrying"
+	EventExpired  = "email.expired"
+)
+
+// DeliveryEvent reports the outcome of one delivery attempt back to the
+// producers. Its Type doubles as the routing key on the events exchange.
+type DeliveryEvent struct {
+	Type         string   `json:"type"`
+	MessageID    string   `json:"messageId,omitempty"`
+	Recipients   []string `json:"recipients,omitempty"`
+	TemplateType string   `json:"templateType,omitempty"`
+	Attempts     int      `json:"attempts"`
+	SMTPResponse string   `json:"smtpResponse,omitempty"`
+	Error        string   `json:"error,omitempty"`
+	// QueuedAt is the request's timestamp, left out when it has none.
+	QueuedAt   *time.Time `json:"queuedAt,omitempty"`
+	OccurredAt time.Time  `json:"occurredAt"`
+}
@@ -3,16 +3,42 @@ package models
 import "time"
 
 type EmailRequest struct {
-	To               string    `json:"to"`
-	Subject          string    `json:"subject"`
-	Timestamp        time.Time `json:"timestamp"`
-	From             string    `json:"from"`
-	SenderName       string    `json:"senderName"`
-	FirstName        string    `json:"firstName,omitempty"`
-	LastName         string    `json:"lastName,omitempty"`
-	UserName         string    `json:"userName,omitempty"`
-	Email            string    `json:"email,omitempty"`
-	UserType         string    `json:"userType,omitempty"`
-	ConfirmationLink string    `json:"confirmationLink,omitempty"`
-	TemplateType     string    `json:"templateType,omitempty"`
-}
\ No newline at end of file
+	ID               string     `json:"id,omitempty"`
+	To               Recipients `json:"to"`
+	Cc               Recipients `json:"cc,omitempty"`
+	Bcc              Recipients `json:"bcc,omitempty"`
+	ReplyTo          Recipients `json:"replyTo,omitempty"`
+	Subject          string     `json:"subject"`
+	Timestamp        time.Time  `json:"timestamp"`
+	SendAt           *time.Time `json:"sendAt,omitempty"`
+	ExpiresAt        *time.Time `json:"expiresAt,omitempty"`
+	From             string     `json:"from"`
+	SenderName       string     `json:"senderName"`
+	FirstName        string     `json:"firstName,omitempty"`
+	LastName         string     `json:"lastName,omitempty"`
+	UserName         string     `json:"userName,omitempty"`
+	Email            string     `json:"email,omitempty"`
+	UserType         string     `json:"userType,omitempty"`
+	ConfirmationLink string     `json:"confirmationLink,omitempty"`
+	TemplateType     string     `json:"templateType,omitempty"`
+	Locale           string     `json:"locale,omitempty"`
+	// Data is passed to the template as is. The confirmation fields above
+	// predate it and are merged in under the same camelCase keys.
+	Data map[string]any `json:"data,omitempty"`
+
+	Attachments []Attachment `json:"attachments,omitempty"`
+
+	// LegacyReplyTo is the reply_to field of the original payload, which
+	// the handler merges into ReplyTo.
+	LegacyReplyTo Recipients `json:"reply_to,omitempty"`
+}
+
+type Attachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType,omitempty"`
+	Content     string `json:"content,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Path        string `json:"path,omitempty"`
+	Inline      bool   `json:"inline,omitempty"`
+	ContentID   string `json:"contentId,omitempty"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+type Recipient struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+// Recipients accepts a single address string, an array of address strings
+// or an array of {email, name} objects, so producers that send the original
+// string "to" field keep working.
+type Recipients []Recipient
+
+func (r *Recipients) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*r = nil
+		if single != "" {
+			*r = Recipients{{Email: single}}
+		}
+		return nil
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		var one Recipient
+		if err := json.Unmarshal(data, &one); err != nil {
+			return err
+		}
+		*r = Recipients{one}
+		return nil
+	}
+
+	recipients := make(Recipients, 0, len(raw))
+	for _, item := range raw {
+		var addr string
+		if err := json.Unmarshal(item, &addr); err == nil {
+			recipients = append(recipients, Recipient{Email: addr})
+			continue
+		}
+		var recipient Recipient
+		if err := json.Unmarshal(item, &recipient); err != nil {
+			return err
+		}
+		recipients = append(recipients, recipient)
+	}
+	*r = recipients
+	return nil
+}
+
+func (r Recipients) String() string {
+	emails := make([]string, len(r))
+	for i, recipient := range r {
+		emails[i] = recipient.Email
+	}
+	return strings.Join(emails, ", ")
+}
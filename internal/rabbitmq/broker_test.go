@@ -0,0 +1,387 @@
+package rabbitmq
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// AMQP 0-9-1 frame types.
+const (
+	frameMethod    = 1
+	frameHeader    = 2
+	frameBody      = 3
+	frameHeartbeat = 8
+	frameEnd       = 0xCE
+)
+
+// fakeBroker speaks just enough AMQP 0-9-1 for the consumer to connect,
+// declare its topology, consume and publish. Tests use it to drop
+// connections and close channels the way a real broker would.
+type fakeBroker struct {
+	t         *testing.T
+	listener  net.Listener
+	consuming chan *fakeConn
+	published chan fakePublishing
+	acks      chan fakeAck
+	// reject makes the broker nack every publish on a confirm-mode channel.
+	reject atomic.Bool
+}
+
+// fakePublishing is a message the client published.
+type fakePublishing struct {
+	exchange   string
+	routingKey string
+}
+
+// fakeAck is the client's ack, nack or reject of a delivery.
+type fakeAck struct {
+	method  string
+	tag     uint64
+	requeue bool
+}
+
+func newFakeBroker(t *testing.T) *fakeBroker {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &fakeBroker{t: t, listener: listener, consuming: make(chan *fakeConn, 16), published: make(chan fakePublishing, 16), acks: make(chan fakeAck, 16)}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			fc := &fakeConn{broker: b, conn: conn, confirming: make(map[uint16]uint64), publishing: make(map[uint16]fakePublishing)}
+			go fc.serve()
+		}
+	}()
+	return b
+}
+
+func (b *fakeBroker) URL() string {
+	return "amqp://guest:guest@" + b.listener.Addr().String() + "/"
+}
+
+// waitPublished returns the next message the client published, skipping
+// status events.
+func (b *fakeBroker) waitPublished() fakePublishing {
+	b.t.Helper()
+	for {
+		select {
+		case p := <-b.published:
+			if p.exchange == "email_events" {
+				continue
+			}
+			return p
+		case <-time.After(5 * time.Second):
+			b.t.Fatal("timed out waiting for a publish")
+			return fakePublishing{}
+		}
+	}
+}
+
+// waitAck returns the next ack, nack or reject the client sent.
+func (b *fakeBroker) waitAck() fakeAck {
+	b.t.Helper()
+	select {
+	case a := <-b.acks:
+		return a
+	case <-time.After(5 * time.Second):
+		b.t.Fatal("timed out waiting for an ack")
+		return fakeAck{}
+	}
+}
+
+// waitConsuming returns the next connection on which the consumer started
+// consuming.
+func (b *fakeBroker) waitConsuming() *fakeConn {
+	b.t.Helper()
+	select {
+	case fc := <-b.consuming:
+		return fc
+	case <-time.After(5 * time.Second):
+		b.t.Fatal("timed out waiting for the consumer to start consuming")
+		return nil
+	}
+}
+
+type fakeConn struct {
+	broker *fakeBroker
+	conn   net.Conn
+
+	mu          sync.Mutex
+	confirming  map[uint16]uint64
+	publishing  map[uint16]fakePublishing
+	consumerTag string
+	closed      bool
+}
+
+// drop closes the socket without a handshake, like a broker crash or a
+// network failure.
+func (fc *fakeConn) drop() {
+	fc.conn.Close()
+}
+
+// closeConnection sends connection.close, like a broker shutting down.
+func (fc *fakeConn) closeConnection(code uint16, text string) {
+	var args frameWriter
+	args.u16(code)
+	args.shortstr(text)
+	args.u16(0)
+	args.u16(0)
+	fc.method(0, 10, 50, args.Bytes())
+}
+
+// closeChannel sends channel.close, like a channel-level error that leaves
+// the connection open.
+func (fc *fakeConn) closeChannel(channel uint16, code uint16, text string) {
+	var args frameWriter
+	args.u16(code)
+	args.shortstr(text)
+	args.u16(0)
+	args.u16(0)
+	fc.method(channel, 20, 40, args.Bytes())
+}
+
+// deliver sends body to the consumer on channel with delivery tag tag.
+func (fc *fakeConn) deliver(channel uint16, tag uint64, body []byte) {
+	fc.mu.Lock()
+	consumerTag := fc.consumerTag
+	fc.mu.Unlock()
+
+	var args frameWriter
+	args.shortstr(consumerTag)
+	args.u64(tag)
+	args.WriteByte(0)
+	args.shortstr("")
+	args.shortstr("email_queue")
+	fc.method(channel, 60, 60, args.Bytes())
+
+	var header frameWriter
+	header.u16(60)
+	header.u16(0)
+	header.u64(uint64(len(body)))
+	header.u16(0)
+	fc.frame(frameHeader, channel, header.Bytes())
+	fc.frame(frameBody, channel, body)
+}
+
+// isClosed reports whether the client closed the connection with a
+// connection.close handshake.
+func (fc *fakeConn) isClosed() bool {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.closed
+}
+
+func (fc *fakeConn) method(channel, class, method uint16, args []byte) {
+	var payload frameWriter
+	payload.u16(class)
+	payload.u16(method)
+	payload.Write(args)
+	fc.frame(frameMethod, channel, payload.Bytes())
+}
+
+func (fc *fakeConn) frame(typ byte, channel uint16, payload []byte) {
+	var f frameWriter
+	f.WriteByte(typ)
+	f.u16(channel)
+	f.u32(uint32(len(payload)))
+	f.Write(payload)
+	f.WriteByte(frameEnd)
+
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.conn.Write(f.Bytes())
+}
+
+func (fc *fakeConn) serve() {
+	defer fc.conn.Close()
+	r := bufio.NewReader(fc.conn)
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil || !bytes.Equal(header, []byte("AMQP\x00\x00\x09\x01")) {
+		return
+	}
+
+	var start frameWriter
+	start.WriteByte(0)
+	start.WriteByte(9)
+	start.u32(0)
+	start.longstr("PLAIN")
+	start.longstr("en_US")
+	fc.method(0, 10, 10, start.Bytes())
+
+	// Outstanding body bytes of the message being published, per channel.
+	pending := make(map[uint16]uint64)
+	for {
+		typ, channel, payload, err := readFrame(r)
+		if err != nil {
+			return
+		}
+
+		switch typ {
+		case frameHeartbeat:
+			fc.frame(frameHeartbeat, 0, nil)
+		case frameHeader:
+			pending[channel] = binary.BigEndian.Uint64(payload[4:12])
+			if pending[channel] == 0 {
+				fc.published(channel)
+			}
+		case frameBody:
+			pending[channel] -= uint64(len(payload))
+			if pending[channel] == 0 {
+				fc.published(channel)
+			}
+		case frameMethod:
+			if !fc.handle(channel, binary.BigEndian.Uint16(payload), binary.BigEndian.Uint16(payload[2:]), payload[4:]) {
+				return
+			}
+		}
+	}
+}
+
+// handle answers one method from the client, returning false once the
+// connection is closed.
+func (fc *fakeConn) handle(channel, class, method uint16, args []byte) bool {
+	var reply frameWriter
+	switch [2]uint16{class, method} {
+	case [2]uint16{10, 11}: // connection.start-ok
+		reply.u16(0)
+		reply.u32(131072)
+		reply.u16(0)
+		fc.method(0, 10, 30, reply.Bytes())
+	case [2]uint16{10, 31}: // connection.tune-ok
+	case [2]uint16{10, 40}: // connection.open
+		reply.shortstr("")
+		fc.method(0, 10, 41, reply.Bytes())
+	case [2]uint16{10, 50}: // connection.close
+		fc.mu.Lock()
+		fc.closed = true
+		fc.mu.Unlock()
+		fc.method(0, 10, 51, nil)
+		return false
+	case [2]uint16{10, 51}: // connection.close-ok
+		return false
+	case [2]uint16{20, 10}: // channel.open
+		reply.longstr("")
+		fc.method(channel, 20, 11, reply.Bytes())
+	case [2]uint16{20, 40}: // channel.close
+		fc.method(channel, 20, 41, nil)
+	case [2]uint16{20, 41}: // channel.close-ok
+	case [2]uint16{40, 10}: // exchange.declare
+		fc.method(channel, 40, 11, nil)
+	case [2]uint16{50, 10}: // queue.declare
+		reply.shortstr(readShortstr(args[2:]))
+		reply.u32(0)
+		reply.u32(0)
+		fc.method(channel, 50, 11, reply.Bytes())
+	case [2]uint16{50, 20}: // queue.bind
+		fc.method(channel, 50, 21, nil)
+	case [2]uint16{60, 10}: // basic.qos
+		fc.method(channel, 60, 11, nil)
+	case [2]uint16{60, 20}: // basic.consume
+		queue := readShortstr(args[2:])
+		tag := readShortstr(args[3+len(queue):])
+		fc.mu.Lock()
+		fc.consumerTag = tag
+		fc.mu.Unlock()
+		reply.shortstr(tag)
+		fc.method(channel, 60, 21, reply.Bytes())
+		fc.broker.consuming <- fc
+	case [2]uint16{60, 30}: // basic.cancel
+		reply.shortstr(readShortstr(args))
+		fc.method(channel, 60, 31, reply.Bytes())
+	case [2]uint16{60, 80}: // basic.ack
+		fc.broker.acks <- fakeAck{method: "ack", tag: binary.BigEndian.Uint64(args)}
+	case [2]uint16{60, 90}: // basic.reject
+		fc.broker.acks <- fakeAck{method: "reject", tag: binary.BigEndian.Uint64(args), requeue: args[8]&1 != 0}
+	case [2]uint16{60, 120}: // basic.nack
+		fc.broker.acks <- fakeAck{method: "nack", tag: binary.BigEndian.Uint64(args), requeue: args[8]&2 != 0}
+	case [2]uint16{60, 40}: // basic.publish, completed by its content frames
+		exchange := readShortstr(args[2:])
+		fc.mu.Lock()
+		fc.publishing[channel] = fakePublishing{exchange: exchange, routingKey: readShortstr(args[3+len(exchange):])}
+		fc.mu.Unlock()
+	case [2]uint16{85, 10}: // confirm.select
+		fc.mu.Lock()
+		fc.confirming[channel] = 0
+		fc.mu.Unlock()
+		fc.method(channel, 85, 11, nil)
+	}
+	return true
+}
+
+// published records a fully received message and confirms it on channels
+// in confirm mode.
+func (fc *fakeConn) published(channel uint16) {
+	fc.mu.Lock()
+	fc.broker.published <- fc.publishing[channel]
+	tag, ok := fc.confirming[channel]
+	if ok {
+		tag++
+		fc.confirming[channel] = tag
+	}
+	fc.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	var confirm frameWriter
+	confirm.u64(tag)
+	confirm.WriteByte(0)
+	if fc.broker.reject.Load() {
+		fc.method(channel, 60, 120, confirm.Bytes()) // basic.nack
+	} else {
+		fc.method(channel, 60, 80, confirm.Bytes()) // basic.ack
+	}
+}
+
+func readFrame(r *bufio.Reader) (byte, uint16, []byte, error) {
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, 0, nil, err
+	}
+	payload := make([]byte, binary.BigEndian.Uint32(header[3:])+1)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, 0, nil, err
+	}
+	if payload[len(payload)-1] != frameEnd {
+		return 0, 0, nil, errors.New("bad frame end")
+	}
+	return header[0], binary.BigEndian.Uint16(header[1:]), payload[:len(payload)-1], nil
+}
+
+func readShortstr(b []byte) string {
+	return string(b[1 : 1+int(b[0])])
+}
+
+type frameWriter struct {
+	bytes.Buffer
+}
+
+func (w *frameWriter) u16(v uint16) { binary.Write(w, binary.BigEndian, v) }
+func (w *frameWriter) u32(v uint32) { binary.Write(w, binary.BigEndian, v) }
+func (w *frameWriter) u64(v uint64) { binary.Write(w, binary.BigEndian, v) }
+
+func (w *frameWriter) shortstr(s string) {
+	w.WriteByte(byte(len(s)))
+	w.WriteString(s)
+}
+
+func (w *frameWriter) longstr(s string) {
+	w.u32(uint32(len(s)))
+	w.WriteString(s)
+}
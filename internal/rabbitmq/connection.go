@@ -0,0 +1,152 @@
+package rabbitmq
+
+import (
+	"log"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type ConnectionState int32
+
+const (
+	StateConnecting ConnectionState = iota
+	StateConnected
+	StateReconnecting
+	StateClosed
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	default:
+		return "closed"
+	}
+}
+
+type stateValue struct {
+	v atomic.Int32
+}
+
+func (s *stateValue) get() ConnectionState {
+	return ConnectionState(s.v.Load())
+}
+
+func (s *stateValue) set(state ConnectionState) {
+	s.v.Store(int32(state))
+}
+
+// State reports the current broker connection state, for health checks.
+func (c *Consumer) State() ConnectionState {
+	return c.state.get()
+}
+
+// closeNotify holds the close notifications of a connection and its
+// channels. Each needs a receiver of its own: amqp091 closes every receiver
+// it was given when the connection shuts down, and closes them again as it
+// shuts down each channel.
+type closeNotify struct {
+	conn    chan *amqp.Error
+	channel chan *amqp.Error
+	// events is nil when no events exchange is configured, which leaves
+	// its case in wait blocked for good.
+	events chan *amqp.Error
+}
+
+// wait blocks until the connection or one of its channels closes, returning
+// the error it closed with.
+func (n closeNotify) wait(done <-chan struct{}) (*amqp.Error, bool) {
+	select {
+	case <-done:
+		return nil, false
+	case err := <-n.conn:
+		return err, true
+	case err := <-n.channel:
+		return err, true
+	case err := <-n.events:
+		return err, true
+	}
+}
+
+// supervise waits for the connection or channel to close and then
+// reconnects, re-declares the topology and restarts the workers.
+func (c *Consumer) supervise() {
+	for {
+		c.mu.Lock()
+		closed, conn := c.closed, c.conn
+		c.mu.Unlock()
+
+		amqpErr, ok := closed.wait(c.done)
+		if !ok {
+			return
+		}
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+		log.Printf("RabbitMQ connection lost: %v", amqpErr)
+
+		c.state.set(StateReconnecting)
+		conn.Close()
+		c.wg.Wait()
+
+		if !c.reconnect() {
+			return
+		}
+	}
+}
+
+// reconnect retries with capped exponential backoff and full jitter until a
+// connection is established and consuming, or the consumer is stopped.
+func (c *Consumer) reconnect() bool {
+	interval := c.config.RabbitMQ.ReconnectInterval
+	for attempt := 1; ; attempt++ {
+		wait := time.Duration(rand.Int63n(int64(interval) + 1))
+		log.Printf("Reconnecting to RabbitMQ in %s (attempt %d)", wait.Round(time.Millisecond), attempt)
+
+		select {
+		case <-c.done:
+			return false
+		case <-time.After(wait):
+		}
+
+		err := c.connect()
+		if err == nil {
+			if err = c.consume(); err != nil {
+				c.closeConnection()
+			}
+		}
+		if err == nil {
+			select {
+			case <-c.done:
+				c.closeConnection()
+				return false
+			default:
+			}
+			log.Printf("Reconnected to RabbitMQ after %d attempts", attempt)
+			return true
+		}
+
+		log.Printf("Failed to reconnect to RabbitMQ: %v", err)
+		c.state.set(StateReconnecting)
+		interval *= 2
+		if interval > c.config.RabbitMQ.ReconnectMaxInterval {
+			interval = c.config.RabbitMQ.ReconnectMaxInterval
+		}
+	}
+}
+
+func (c *Consumer) closeConnection() {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	conn.Close()
+}
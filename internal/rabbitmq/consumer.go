@@ -1,11 +1,19 @@
 package rabbitmq
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"aptiverse-email/internal/config"
+	"aptiverse-email/internal/dedup"
 	"aptiverse-email/internal/email"
 	"aptiverse-email/internal/handlers"
 	"aptiverse-email/internal/models"
@@ -13,28 +21,113 @@ import (
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
+var errStopping = errors.New("consumer is stopping")
+
 type Consumer struct {
 	config    *config.Config
-	conn      *amqp.Connection
-	channel   *amqp.Channel
-	emailSvc  *email.Sender
-	isRunning bool
+	transport email.Transport
+	dedup     dedup.Store
+	tag       string
+	state     stateValue
+	stopping  atomic.Bool
+	done      chan struct{}
 	wg        sync.WaitGroup
+	inFlight  inFlight
+
+	mu      sync.Mutex
+	conn    *amqp.Connection
+	channel *amqp.Channel
+	events  *amqp.Channel
+	closed  closeNotify
 }
 
 func NewConsumer(cfg *config.Config) (*Consumer, error) {
-	conn, err := amqp.Dial(cfg.RabbitMQ.URL)
+	transport, err := email.NewTransport(cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	channel, err := conn.Channel()
+	store, err := dedup.New(cfg.Dedup)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = channel.QueueDeclare(
-		cfg.RabbitMQ.QueueName,
+	hostname, _ := os.Hostname()
+	c := &Consumer{
+		config:    cfg,
+		transport: transport,
+		dedup:     store,
+		tag:       fmt.Sprintf("email-service-%s-%d", hostname, os.Getpid()),
+		done:      make(chan struct{}),
+		inFlight:  inFlight{deliveries: make(map[*amqp.Delivery]struct{})},
+	}
+	c.state.set(StateConnecting)
+
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// connect dials the broker and declares the queue topology and QoS on a
+// fresh channel. It is used both on startup and when reconnecting.
+func (c *Consumer) connect() error {
+	conn, err := amqp.Dial(c.config.RabbitMQ.URL)
+	if err != nil {
+		return err
+	}
+
+	channel, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	if err := c.declare(channel); err != nil {
+		conn.Close()
+		return err
+	}
+
+	// Retries and dead letters are republished on this channel, and the
+	// original delivery is only acked once the broker confirms the copy.
+	if err := channel.Confirm(false); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to enable publisher confirms: %v", err)
+	}
+
+	var events *amqp.Channel
+	if c.config.RabbitMQ.EventsExchange != "" {
+		events, err = openEventsChannel(conn, c.config.RabbitMQ.EventsExchange)
+		if err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	// Listen on every channel so that a channel-level error, which leaves
+	// the connection open, also triggers a reconnect.
+	closed := closeNotify{
+		conn:    conn.NotifyClose(make(chan *amqp.Error, 1)),
+		channel: channel.NotifyClose(make(chan *amqp.Error, 1)),
+	}
+	if events != nil {
+		closed.events = events.NotifyClose(make(chan *amqp.Error, 1))
+	}
+
+	c.mu.Lock()
+	c.conn = conn
+	c.channel = channel
+	c.events = events
+	c.closed = closed
+	c.mu.Unlock()
+
+	c.state.set(StateConnected)
+	return nil
+}
+
+func (c *Consumer) declare(channel *amqp.Channel) error {
+	_, err := channel.QueueDeclare(
+		c.config.RabbitMQ.QueueName,
 		true,
 		false,
 		false,
@@ -42,86 +135,238 @@ func NewConsumer(cfg *config.Config) (*Consumer, error) {
 		nil,
 	)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	if err := declareRetryTopology(channel, c.config); err != nil {
+		return err
 	}
 
-	err = channel.Qos(
-		cfg.App.MaxWorkers,
+	if err := declareScheduleTopology(channel, c.config); err != nil {
+		return err
+	}
+
+	return channel.Qos(
+		c.config.App.MaxWorkers,
 		0,
 		false,
 	)
+}
+
+func (c *Consumer) Start() error {
+	if err := c.consume(); err != nil {
+		return err
+	}
+
+	go c.supervise()
+	return nil
+}
+
+// consume starts a new generation of workers on the current channel. It
+// holds mu so that Stop cannot begin waiting on the workers while new ones
+// are being added.
+func (c *Consumer) consume() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stopping.Load() {
+		return errStopping
+	}
+
+	log.Printf("Declaring queue: %s", c.config.RabbitMQ.QueueName)
+
+	msgs, err := c.channel.Consume(
+		c.config.RabbitMQ.QueueName,
+		c.tag,
+		false,
+		false,
+		false,
+		false,
+		nil,
+	)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	emailSvc := email.NewSender(cfg)
+	log.Printf("Successfully started consuming from queue: %s", c.config.RabbitMQ.QueueName)
 
-	return &Consumer{
-		config:    cfg,
-		conn:      conn,
-		channel:   channel,
-		emailSvc:  emailSvc,
-		isRunning: true,
-	}, nil
+	for i := 0; i < c.config.App.MaxWorkers; i++ {
+		c.wg.Add(1)
+		go c.worker(msgs, i)
+	}
+
+	log.Printf("Started %d email workers", c.config.App.MaxWorkers)
+	return nil
 }
 
-func (c *Consumer) Start() error {
-    log.Printf("Declaring queue: %s", c.config.RabbitMQ.QueueName)
-    
-    msgs, err := c.channel.Consume(
-        c.config.RabbitMQ.QueueName,
-        "",
-        false,
-        false,
-        false,
-        false,
-        nil,
-    )
-    if err != nil {
-        return err
-    }
-
-    log.Printf("Successfully started consuming from queue: %s", c.config.RabbitMQ.QueueName)
-
-    for i := 0; i < c.config.App.MaxWorkers; i++ {
-        c.wg.Add(1)
-        go c.worker(msgs, i)
-    }
-
-    log.Printf("Started %d email workers", c.config.App.MaxWorkers)
-    return nil
+func (c *Consumer) currentChannel() *amqp.Channel {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.channel
 }
 
 func (c *Consumer) worker(msgs <-chan amqp.Delivery, workerID int) {
 	defer c.wg.Done()
 
-	for c.isRunning {
-		msg, ok := <-msgs
-		if !ok {
+	for msg := range msgs {
+		// Deliveries still buffered after the consumer was cancelled go
+		// back to the queue untouched.
+		if c.stopping.Load() {
+			msg.Nack(false, true)
+			continue
+		}
+
+		c.inFlight.add(&msg)
+		c.process(msg, workerID)
+		c.inFlight.remove(&msg)
+	}
+}
+
+func (c *Consumer) process(msg amqp.Delivery, workerID int) {
+	var emailReq models.EmailRequest
+	if err := json.Unmarshal(msg.Body, &emailReq); err != nil {
+		log.Printf("Worker %d: Failed to parse message: %v", workerID, err)
+		c.deadLetter(msg, nil, &handlers.ValidationError{Err: err})
+		return
+	}
+
+	if err := handlers.CheckExpiry(&emailReq, c.config, time.Now()); err != nil {
+		c.handleFailure(msg, &emailReq, err, workerID)
+		return
+	}
+
+	if emailReq.SendAt != nil && time.Until(*emailReq.SendAt) > 0 {
+		c.schedule(msg, *emailReq.SendAt, workerID)
+		return
+	}
+
+	key := emailReq.ID
+	if key == "" {
+		key = msg.MessageId
+	}
+	if key != "" && c.dedup != nil {
+		status, err := c.dedup.Acquire(key)
+		switch {
+		case err != nil:
+			c.handleFailure(msg, &emailReq, fmt.Errorf("dedup store unavailable: %w", err), workerID)
+			return
+		case status == dedup.Sent:
+			log.Printf("Worker %d: Skipping duplicate email %s, already sent", workerID, key)
+			msg.Ack(false)
+			return
+		case status == dedup.InProgress:
+			c.waitForLock(msg, key, workerID)
 			return
 		}
+	}
 
-		var emailReq models.EmailRequest
-		if err := json.Unmarshal(msg.Body, &emailReq); err != nil {
-			log.Printf("Worker %d: Failed to parse message: %v", workerID, err)
-			msg.Nack(false, false)
-			continue
+	response, err := handlers.HandleEmailMessage(&emailReq, c.transport, c.config)
+	if err != nil {
+		if key != "" && c.dedup != nil {
+			if releaseErr := c.dedup.Release(key); releaseErr != nil {
+				log.Printf("Worker %d: Failed to release dedup key %s: %v", workerID, key, releaseErr)
+			}
 		}
+		c.handleFailure(msg, &emailReq, err, workerID)
+		return
+	}
 
-		if err := handlers.HandleEmailMessage(&emailReq, c.emailSvc); err != nil {
-			log.Printf("Worker %d: Failed to process email: %v", workerID, err)
-			msg.Nack(false, true)
-		} else {
-			msg.Ack(false)
-			log.Printf("Worker %d: Successfully sent email to %s", workerID, emailReq.To)
+	if key != "" && c.dedup != nil {
+		if err := c.dedup.Complete(key); err != nil {
+			log.Printf("Worker %d: Failed to record email %s as sent: %v", workerID, key, err)
 		}
 	}
+
+	msg.Ack(false)
+	log.Printf("Worker %d: Successfully sent email to %s", workerID, emailReq.To)
+	c.publishEvent(models.EventSent, msg, &emailReq, retryCount(msg.Headers)+1, response, nil)
 }
 
-func (c *Consumer) Stop() {
-	c.isRunning = false
-	c.wg.Wait()
-	c.channel.Close()
-	c.conn.Close()
+func (c *Consumer) handleFailure(msg amqp.Delivery, req *models.EmailRequest, err error, workerID int) {
+	switch handlers.Classify(err) {
+	case handlers.Permanent:
+		log.Printf("Worker %d: Permanent failure, dead-lettering message: %v", workerID, err)
+		c.deadLetter(msg, req, err)
+	case handlers.Expired:
+		log.Printf("Worker %d: Dropping stale message to the dead-letter queue: %v", workerID, err)
+		c.deadLetter(msg, req, err)
+	case handlers.Misconfigured:
+		log.Printf("ALERT: Worker %d: Email delivery is misconfigured, check the service configuration: %v", workerID, err)
+		c.retry(msg, req, err)
+	default:
+		log.Printf("Worker %d: Failed to process email: %v", workerID, err)
+		c.retry(msg, req, err)
+	}
+}
+
+// Stop cancels the AMQP consumer and waits for in-flight emails to finish.
+// If ctx expires first, unfinished deliveries are requeued before the
+// channel and connection are closed.
+func (c *Consumer) Stop(ctx context.Context) error {
+	c.mu.Lock()
+	c.stopping.Store(true)
+	channel, conn := c.channel, c.conn
+	c.mu.Unlock()
+
+	close(c.done)
+	c.state.set(StateClosed)
+
+	if err := channel.Cancel(c.tag, false); err != nil {
+		log.Printf("Failed to cancel consumer %s: %v", c.tag, err)
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(finished)
+	}()
+
+	var err error
+	select {
+	case <-finished:
+		log.Println("All in-flight emails finished")
+	case <-ctx.Done():
+		requeued := c.inFlight.requeue()
+		log.Printf("Shutdown deadline exceeded, requeued %d in-flight messages", requeued)
+		err = ctx.Err()
+	}
+
+	channel.Close()
+	conn.Close()
+	if closer, ok := c.transport.(io.Closer); ok {
+		closer.Close()
+	}
+	if c.dedup != nil {
+		c.dedup.Close()
+	}
 	log.Println("RabbitMQ consumer stopped")
-}
\ No newline at end of file
+	return err
+}
+
+// inFlight tracks deliveries that workers are currently processing.
+type inFlight struct {
+	mu         sync.Mutex
+	deliveries map[*amqp.Delivery]struct{}
+}
+
+func (f *inFlight) add(d *amqp.Delivery) {
+	f.mu.Lock()
+	f.deliveries[d] = struct{}{}
+	f.mu.Unlock()
+}
+
+func (f *inFlight) remove(d *amqp.Delivery) {
+	f.mu.Lock()
+	delete(f.deliveries, d)
+	f.mu.Unlock()
+}
+
+func (f *inFlight) requeue() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for d := range f.deliveries {
+		d.Nack(false, true)
+	}
+	return len(f.deliveries)
+}
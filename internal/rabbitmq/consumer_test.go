@@ -0,0 +1,202 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"aptiverse-email/internal/config"
+	"aptiverse-email/internal/dedup"
+	"aptiverse-email/internal/email"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func newTestConsumer(t *testing.T, broker *fakeBroker) *Consumer {
+	t.Helper()
+	return startTestConsumer(t, broker, nil)
+}
+
+// startTestConsumer starts a consumer that sends emails with transport, or
+// only logs them when transport is nil.
+func startTestConsumer(t *testing.T, broker *fakeBroker, transport email.Transport) *Consumer {
+	t.Helper()
+	cfg := &config.Config{
+		RabbitMQ: config.RabbitMQConfig{
+			URL:                  broker.URL(),
+			QueueName:            "email_queue",
+			DeadLetterExchange:   "email_dlx",
+			DeadLetterQueue:      "email_dead",
+			EventsExchange:       "email_events",
+			ReconnectInterval:    10 * time.Millisecond,
+			ReconnectMaxInterval: 50 * time.Millisecond,
+		},
+		Retry: config.RetryConfig{
+			MaxAttempts:       3,
+			BackoffMultiplier: 2,
+			InitialInterval:   time.Second,
+			MaxInterval:       time.Hour,
+		},
+		SMTP:  config.SMTPConfig{From: "no-reply@aptiverse.co.za"},
+		Email: config.EmailConfig{Transport: "log"},
+		Dedup: config.DedupConfig{Backend: "memory", Window: time.Hour, LockTTL: 5 * time.Minute},
+		App:   config.AppConfig{MaxWorkers: 2},
+	}
+
+	c, err := NewConsumer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transport != nil {
+		c.transport = transport
+	}
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func waitForState(t *testing.T, c *Consumer, want ConnectionState) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for c.State() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("consumer is %s, want %s", c.State(), want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func stopConsumer(t *testing.T, c *Consumer) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Stop(ctx); err != nil {
+		t.Errorf("Stop() = %v, want a graceful stop", err)
+	}
+	if c.State() != StateClosed {
+		t.Errorf("consumer is %s after Stop, want closed", c.State())
+	}
+}
+
+func TestConsumerReconnects(t *testing.T) {
+	tests := []struct {
+		name string
+		lose func(*fakeConn)
+	}{
+		{"network failure", (*fakeConn).drop},
+		{"broker shutdown", func(fc *fakeConn) { fc.closeConnection(320, "CONNECTION_FORCED - broker forced connection closure") }},
+		{"channel error", func(fc *fakeConn) { fc.closeChannel(1, 406, "PRECONDITION_FAILED - unknown delivery tag 1") }},
+		{"events channel error", func(fc *fakeConn) { fc.closeChannel(2, 404, "NOT_FOUND - no exchange 'email_events'") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := newFakeBroker(t)
+			c := newTestConsumer(t, broker)
+			first := broker.waitConsuming()
+
+			tt.lose(first)
+			second := broker.waitConsuming()
+			if second == first {
+				t.Fatal("consumer resumed on the lost connection")
+			}
+			waitForState(t, c, StateConnected)
+
+			// A second failure exercises the receivers of the new
+			// connection.
+			tt.lose(second)
+			broker.waitConsuming()
+			waitForState(t, c, StateConnected)
+
+			stopConsumer(t, c)
+		})
+	}
+}
+
+func TestConsumerStopsGracefully(t *testing.T) {
+	broker := newFakeBroker(t)
+	c := newTestConsumer(t, broker)
+	fc := broker.waitConsuming()
+
+	stopConsumer(t, c)
+	if !fc.isClosed() {
+		t.Error("Stop did not close the broker connection")
+	}
+
+	// Nothing may reconnect once stopped.
+	select {
+	case <-broker.consuming:
+		t.Error("consumer reconnected after Stop")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// blockingTransport holds every send until release is closed.
+type blockingTransport struct {
+	sending chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingTransport) Send(from string, recipients []string, msg []byte) (string, error) {
+	b.sending <- struct{}{}
+	<-b.release
+	return "250 OK", nil
+}
+
+func TestConsumerRequeuesUnfinishedEmailsAtDeadline(t *testing.T) {
+	broker := newFakeBroker(t)
+	transport := &blockingTransport{sending: make(chan struct{}, 1), release: make(chan struct{})}
+	defer close(transport.release)
+	c := startTestConsumer(t, broker, transport)
+	fc := broker.waitConsuming()
+
+	fc.deliver(1, 1, []byte(`{"to": "ann@example.com", "templateType": "email_confirmation", "firstName": "Ann", "confirmationLink": "https://aptiverse.co.za/confirm?token=1"}`))
+	select {
+	case <-transport.sending:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the delivery never reached the transport")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := c.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Stop() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if got, want := broker.waitAck(), (fakeAck{method: "nack", tag: 1, requeue: true}); got != want {
+		t.Errorf("unfinished delivery got %+v, want %+v", got, want)
+	}
+	if !fc.isClosed() {
+		t.Error("Stop did not close the broker connection")
+	}
+}
+
+func TestConsumerWaitsForLockedEmail(t *testing.T) {
+	broker := newFakeBroker(t)
+	c := newTestConsumer(t, broker)
+	broker.waitConsuming()
+	defer stopConsumer(t, c)
+
+	if status, err := c.dedup.Acquire("welcome-1"); err != nil || status != dedup.Acquired {
+		t.Fatalf("Acquire() = %v, %v", status, err)
+	}
+
+	ack := &fakeAcknowledger{}
+	c.process(amqp.Delivery{
+		Acknowledger: ack,
+		Headers:      amqp.Table{retryCountHeader: int32(1)},
+		Body:         []byte(`{"id": "welcome-1", "to": "ann@example.com", "templateType": "email_confirmation"}`),
+	}, 0)
+
+	if got := broker.waitPublished(); got.routingKey != "email_queue.delay.5m0s" {
+		t.Errorf("locked email published to %q, want the lock TTL delay queue", got.routingKey)
+	}
+	if !ack.acked || ack.nacked {
+		t.Errorf("acked=%v nacked=%v, want the original acked", ack.acked, ack.nacked)
+	}
+	select {
+	case p := <-broker.published:
+		t.Errorf("unexpected publish to %q/%q while waiting for a lock", p.exchange, p.routingKey)
+	default:
+	}
+}
@@ -0,0 +1,125 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"aptiverse-email/internal/email"
+	"aptiverse-email/internal/models"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const eventPublishTimeout = 5 * time.Second
+
+// openEventsChannel opens a dedicated channel in confirm mode for status
+// events and declares the topic exchange they are published to.
+func openEventsChannel(conn *amqp.Connection, exchange string) (*amqp.Channel, error) {
+	channel, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := channel.Confirm(false); err != nil {
+		return nil, fmt.Errorf("failed to enable publisher confirms: %v", err)
+	}
+
+	err = channel.ExchangeDeclare(
+		exchange,
+		"topic",
+		true,
+		false,
+		false,
+		false,
+		nil,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to declare events exchange: %v", err)
+	}
+
+	return channel, nil
+}
+
+// publishEvent reports a delivery outcome and waits for the broker to
+// confirm it. Failures are logged but never affect the email itself.
+func (c *Consumer) publishEvent(eventType string, msg amqp.Delivery, req *models.EmailRequest, attempts int, response string, cause error) {
+	if c.config.RabbitMQ.EventsExchange == "" {
+		return
+	}
+
+	event := models.DeliveryEvent{
+		Type:         eventType,
+		MessageID:    messageID(msg, req),
+		Attempts:     attempts,
+		SMTPResponse: response,
+		OccurredAt:   time.Now().UTC(),
+	}
+	if req != nil {
+		for _, list := range []models.Recipients{req.To, req.Cc, req.Bcc} {
+			for _, r := range list {
+				event.Recipients = append(event.Recipients, r.Email)
+			}
+		}
+		event.TemplateType = req.TemplateType
+		if !req.Timestamp.IsZero() {
+			queuedAt := req.Timestamp
+			event.QueuedAt = &queuedAt
+		}
+	}
+	if cause != nil {
+		event.Error = cause.Error()
+		var smtpErr *email.SMTPError
+		if errors.As(cause, &smtpErr) {
+			event.SMTPResponse = fmt.Sprintf("%d %s", smtpErr.Code, smtpErr.Message)
+		}
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to encode %s event: %v", eventType, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), eventPublishTimeout)
+	defer cancel()
+
+	c.mu.Lock()
+	channel := c.events
+	c.mu.Unlock()
+
+	confirmation, err := channel.PublishWithDeferredConfirmWithContext(
+		ctx,
+		c.config.RabbitMQ.EventsExchange,
+		eventType,
+		false,
+		false,
+		amqp.Publishing{
+			ContentType:   "application/json",
+			DeliveryMode:  amqp.Persistent,
+			CorrelationId: msg.MessageId,
+			Timestamp:     event.OccurredAt,
+			Type:          eventType,
+			Body:          body,
+		},
+	)
+	if err != nil {
+		log.Printf("Failed to publish %s event for message %s: %v", eventType, msg.MessageId, err)
+		return
+	}
+
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil || !acked {
+		log.Printf("Broker did not confirm %s event for message %s: %v", eventType, msg.MessageId, err)
+	}
+}
+
+func messageID(msg amqp.Delivery, req *models.EmailRequest) string {
+	if req != nil && req.ID != "" {
+		return req.ID
+	}
+	return msg.MessageId
+}
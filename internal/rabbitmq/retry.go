@@ -0,0 +1,202 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"aptiverse-email/internal/config"
+	"aptiverse-email/internal/handlers"
+	"aptiverse-email/internal/models"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	retryCountHeader = "x-retry-count"
+	errorHeader      = "x-last-error"
+	errorClassHeader = "x-error-class"
+)
+
+const republishTimeout = 10 * time.Second
+
+// declareRetryTopology declares one delay queue per retry attempt and the
+// dead-letter exchange and queue. A delay queue holds messages for its TTL
+// and then dead-letters them back onto the main queue.
+func declareRetryTopology(ch *amqp.Channel, cfg *config.Config) error {
+	for attempt := 1; attempt <= cfg.Retry.MaxAttempts; attempt++ {
+		delay := retryDelay(cfg.Retry, attempt)
+		_, err := ch.QueueDeclare(
+			retryQueueName(cfg.RabbitMQ.QueueName, delay),
+			true,
+			false,
+			false,
+			false,
+			amqp.Table{
+				"x-message-ttl":             delay.Milliseconds(),
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": cfg.RabbitMQ.QueueName,
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to declare retry queue: %v", err)
+		}
+	}
+
+	err := ch.ExchangeDeclare(
+		cfg.RabbitMQ.DeadLetterExchange,
+		"direct",
+		true,
+		false,
+		false,
+		false,
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to declare dead-letter exchange: %v", err)
+	}
+
+	_, err = ch.QueueDeclare(
+		cfg.RabbitMQ.DeadLetterQueue,
+		true,
+		false,
+		false,
+		false,
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to declare dead-letter queue: %v", err)
+	}
+
+	return ch.QueueBind(
+		cfg.RabbitMQ.DeadLetterQueue,
+		cfg.RabbitMQ.QueueName,
+		cfg.RabbitMQ.DeadLetterExchange,
+		false,
+		nil,
+	)
+}
+
+// retryDelay returns the backoff before the given retry attempt (1-based).
+func retryDelay(cfg config.RetryConfig, attempt int) time.Duration {
+	delay := float64(cfg.InitialInterval) * math.Pow(cfg.BackoffMultiplier, float64(attempt-1))
+	if cfg.MaxInterval > 0 && delay > float64(cfg.MaxInterval) {
+		return cfg.MaxInterval
+	}
+	return time.Duration(delay)
+}
+
+func retryQueueName(queue string, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%s", queue, delay)
+}
+
+func retryCount(headers amqp.Table) int {
+	switch v := headers[retryCountHeader].(type) {
+	case int:
+		return v
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	default:
+		return 0
+	}
+}
+
+// retry schedules another attempt for msg, or dead-letters it once the
+// configured attempts are used up. The original delivery is acked only after
+// the broker has confirmed the copy.
+func (c *Consumer) retry(msg amqp.Delivery, req *models.EmailRequest, cause error) {
+	attempt := retryCount(msg.Headers) + 1
+	if attempt > c.config.Retry.MaxAttempts {
+		log.Printf("Giving up on message %s after %d retries: %v", msg.MessageId, attempt-1, cause)
+		c.deadLetter(msg, req, cause)
+		return
+	}
+
+	delay := retryDelay(c.config.Retry, attempt)
+	err := c.republish(msg, "", retryQueueName(c.config.RabbitMQ.QueueName, delay), amqp.Table{
+		retryCountHeader: int32(attempt),
+		errorHeader:      cause.Error(),
+	})
+	if err != nil {
+		log.Printf("Failed to schedule retry, requeueing message: %v", err)
+		msg.Nack(false, true)
+		return
+	}
+
+	log.Printf("Scheduled retry %d/%d in %s", attempt, c.config.Retry.MaxAttempts, delay)
+	msg.Ack(false)
+	c.publishEvent(models.EventRetrying, msg, req, attempt, "", cause)
+}
+
+func (c *Consumer) deadLetter(msg amqp.Delivery, req *models.EmailRequest, cause error) {
+	err := c.republish(msg, c.config.RabbitMQ.DeadLetterExchange, c.config.RabbitMQ.QueueName, amqp.Table{
+		errorHeader:      cause.Error(),
+		errorClassHeader: handlers.Classify(cause).String(),
+	})
+	if err != nil {
+		log.Printf("Failed to dead-letter message, requeueing: %v", err)
+		msg.Nack(false, true)
+		return
+	}
+	msg.Ack(false)
+
+	eventType := models.EventFailed
+	if handlers.Classify(cause) == handlers.Expired {
+		eventType = models.EventExpired
+	}
+	c.publishEvent(eventType, msg, req, retryCount(msg.Headers)+1, "", cause)
+}
+
+// republish copies msg to exchange and routingKey with extra headers, and
+// returns once the broker has confirmed the copy. Callers ack the original
+// only after that, so a failed publish leaves the message on its queue.
+func (c *Consumer) republish(msg amqp.Delivery, exchange, routingKey string, headers amqp.Table) error {
+	merged := amqp.Table{}
+	for k, v := range msg.Headers {
+		merged[k] = v
+	}
+	for k, v := range headers {
+		merged[k] = v
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), republishTimeout)
+	defer cancel()
+
+	confirmation, err := c.currentChannel().PublishWithDeferredConfirmWithContext(
+		ctx,
+		exchange,
+		routingKey,
+		false,
+		false,
+		amqp.Publishing{
+			Headers:         merged,
+			ContentType:     msg.ContentType,
+			ContentEncoding: msg.ContentEncoding,
+			DeliveryMode:    amqp.Persistent,
+			CorrelationId:   msg.CorrelationId,
+			ReplyTo:         msg.ReplyTo,
+			MessageId:       msg.MessageId,
+			Timestamp:       msg.Timestamp,
+			Type:            msg.Type,
+			AppId:           msg.AppId,
+			Body:            msg.Body,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("broker did not confirm the copy: %v", err)
+	}
+	if !acked {
+		return errors.New("broker rejected the copy")
+	}
+	return nil
+}
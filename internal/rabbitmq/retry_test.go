@@ -0,0 +1,99 @@
+package rabbitmq
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"aptiverse-email/internal/handlers"
+	"aptiverse-email/internal/models"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// fakeAcknowledger records how a delivery was settled.
+type fakeAcknowledger struct {
+	mu       sync.Mutex
+	acked    bool
+	nacked   bool
+	requeued bool
+}
+
+func (a *fakeAcknowledger) Ack(tag uint64, multiple bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.acked = true
+	return nil
+}
+
+func (a *fakeAcknowledger) Nack(tag uint64, multiple, requeue bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.nacked = true
+	a.requeued = requeue
+	return nil
+}
+
+func (a *fakeAcknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+func TestRepublishAcksOnlyConfirmedCopies(t *testing.T) {
+	tests := []struct {
+		name       string
+		republish  func(*Consumer, amqp.Delivery)
+		exchange   string
+		routingKey string
+	}{
+		{
+			name: "retry",
+			republish: func(c *Consumer, msg amqp.Delivery) {
+				c.retry(msg, &models.EmailRequest{}, errors.New("connection reset"))
+			},
+			routingKey: "email_queue.retry.1s",
+		},
+		{
+			name: "dead letter",
+			republish: func(c *Consumer, msg amqp.Delivery) {
+				c.deadLetter(msg, &models.EmailRequest{}, &handlers.ValidationError{Err: errors.New("no recipients")})
+			},
+			exchange:   "email_dlx",
+			routingKey: "email_queue",
+		},
+		{
+			name: "schedule",
+			republish: func(c *Consumer, msg amqp.Delivery) {
+				c.schedule(msg, time.Now().Add(90*time.Second), 0)
+			},
+			routingKey: "email_queue.delay.1m0s",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := newFakeBroker(t)
+			c := newTestConsumer(t, broker)
+			broker.waitConsuming()
+			defer stopConsumer(t, c)
+
+			confirmed := &fakeAcknowledger{}
+			tt.republish(c, amqp.Delivery{Acknowledger: confirmed, MessageId: "m1", Body: []byte(`{}`)})
+			if got := broker.waitPublished(); got.exchange != tt.exchange || got.routingKey != tt.routingKey {
+				t.Errorf("published to %q/%q, want %q/%q", got.exchange, got.routingKey, tt.exchange, tt.routingKey)
+			}
+			if !confirmed.acked || confirmed.nacked {
+				t.Errorf("confirmed copy: acked=%v nacked=%v, want the original acked", confirmed.acked, confirmed.nacked)
+			}
+
+			broker.reject.Store(true)
+			rejected := &fakeAcknowledger{}
+			tt.republish(c, amqp.Delivery{Acknowledger: rejected, MessageId: "m2", Body: []byte(`{}`)})
+			if got := broker.waitPublished(); got.routingKey != tt.routingKey {
+				t.Errorf("published to %q, want %q", got.routingKey, tt.routingKey)
+			}
+			if rejected.acked || !rejected.nacked || !rejected.requeued {
+				t.Errorf("rejected copy: acked=%v nacked=%v requeued=%v, want the original requeued", rejected.acked, rejected.nacked, rejected.requeued)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package rabbitmq
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"aptiverse-email/internal/config"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// delayBuckets are the fixed delays available to scheduled messages. A
+// message waiting for its sendAt time hops through the largest bucket that
+// does not overshoot, so it is redelivered at most a second late however far
+// out it was scheduled, and a queue never holds messages with mixed TTLs.
+var delayBuckets = []time.Duration{
+	6 * time.Hour,
+	time.Hour,
+	15 * time.Minute,
+	5 * time.Minute,
+	time.Minute,
+	30 * time.Second,
+	5 * time.Second,
+	time.Second,
+}
+
+// declareScheduleTopology declares the delay queues used for scheduled
+// sending, plus one sized to the dedup lock TTL for messages whose key is
+// held by another worker. Like the retry queues, they dead-letter expired
+// messages back onto the main queue, where sendAt is checked again.
+func declareScheduleTopology(ch *amqp.Channel, cfg *config.Config) error {
+	delays := delayBuckets
+	if !slices.Contains(delays, cfg.Dedup.LockTTL) {
+		delays = append(slices.Clip(delays), cfg.Dedup.LockTTL)
+	}
+	for _, delay := range delays {
+		_, err := ch.QueueDeclare(
+			delayQueueName(cfg.RabbitMQ.QueueName, delay),
+			true,
+			false,
+			false,
+			false,
+			amqp.Table{
+				"x-message-ttl":             delay.Milliseconds(),
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": cfg.RabbitMQ.QueueName,
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to declare delay queue: %v", err)
+		}
+	}
+	return nil
+}
+
+func delayQueueName(queue string, delay time.Duration) string {
+	return fmt.Sprintf("%s.delay.%s", queue, delay)
+}
+
+// delayBucket returns the largest bucket that fits within remaining.
+func delayBucket(remaining time.Duration) time.Duration {
+	for _, delay := range delayBuckets {
+		if delay <= remaining {
+			return delay
+		}
+	}
+	return delayBuckets[len(delayBuckets)-1]
+}
+
+// schedule parks msg in a delay queue until it is closer to sendAt. The
+// original delivery is acked only after the broker has confirmed the copy,
+// so a crash in between can at worst leave a duplicate, which dedup
+// suppresses.
+func (c *Consumer) schedule(msg amqp.Delivery, sendAt time.Time, workerID int) {
+	delay := delayBucket(time.Until(sendAt))
+	err := c.republish(msg, "", delayQueueName(c.config.RabbitMQ.QueueName, delay), nil)
+	if err != nil {
+		log.Printf("Worker %d: Failed to schedule message, requeueing: %v", workerID, err)
+		msg.Nack(false, true)
+		return
+	}
+
+	log.Printf("Worker %d: Holding message %s until %s", workerID, msg.MessageId, sendAt.Format(time.RFC3339))
+	msg.Ack(false)
+}
+
+// waitForLock parks msg for the dedup lock TTL while another worker holds
+// its key. By the time it comes back that worker has either sent the email,
+// so it is skipped as a duplicate, or died and let the lock expire. Waiting
+// is not a failed attempt, so the retry count is left alone and no retrying
+// event is published.
+func (c *Consumer) waitForLock(msg amqp.Delivery, key string, workerID int) {
+	ttl := c.config.Dedup.LockTTL
+	err := c.republish(msg, "", delayQueueName(c.config.RabbitMQ.QueueName, ttl), nil)
+	if err != nil {
+		log.Printf("Worker %d: Failed to delay locked email %s, requeueing: %v", workerID, key, err)
+		msg.Nack(false, true)
+		return
+	}
+
+	log.Printf("Worker %d: Email %s is being sent by another worker, checking again in %s", workerID, key, ttl)
+	msg.Ack(false)
+}
@@ -0,0 +1,216 @@
+package templates
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultLocale ends every fallback chain.
+const defaultLocale = "en"
+
+// pluralForms are the CLDR plural categories a message may define.
+var pluralForms = map[string]bool{
+	"zero": true, "one": true, "two": true, "few": true, "many": true, "other": true,
+}
+
+// message is one translated string. Messages without plural forms only set
+// "other".
+type message map[string]string
+
+// catalog maps dotted message keys to messages for one locale.
+type catalog map[string]message
+
+// parseCatalog reads a JSON or YAML catalog. Nested objects become dotted
+// keys, and an object made only of plural categories is a plural message:
+//
+//	confirmation:
+//	  heading: Welcome to Aptiverse!
+//	  expires:
+//	    one: This link expires in {count} hour.
+//	    other: This link expires in {count} hours.
+func parseCatalog(data []byte) (catalog, error) {
+	var tree map[string]any
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	c := make(catalog)
+	if err := c.add("", tree); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c catalog) add(prefix string, tree map[string]any) error {
+	for key, value := range tree {
+		key = joinPath(prefix, key)
+		switch v := value.(type) {
+		case string:
+			c[key] = message{"other": v}
+		case map[string]any:
+			if isPlural(v) {
+				m := make(message, len(v))
+				for form, text := range v {
+					m[form] = fmt.Sprint(text)
+				}
+				c[key] = m
+				continue
+			}
+			if err := c.add(key, v); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%s: expected a string or an object", key)
+		}
+	}
+	return nil
+}
+
+func isPlural(tree map[string]any) bool {
+	if _, ok := tree["other"]; !ok {
+		return false
+	}
+	for form, value := range tree {
+		if _, ok := value.(string); !ok || !pluralForms[form] {
+			return false
+		}
+	}
+	return true
+}
+
+// translator renders messages for one locale, falling back through
+// less specific locales to defaultLocale.
+type translator struct {
+	locale   string
+	chain    []string
+	catalogs map[string]catalog
+}
+
+func newTranslator(catalogs map[string]catalog, locale string) *translator {
+	chain := localeChain(locale)
+	if len(chain) == 0 || chain[len(chain)-1] != defaultLocale {
+		chain = append(chain, defaultLocale)
+	}
+
+	tr := &translator{locale: defaultLocale, chain: chain, catalogs: catalogs}
+	for _, l := range chain {
+		if _, ok := catalogs[l]; ok {
+			tr.locale = l
+			break
+		}
+	}
+	return tr
+}
+
+// translate looks up key and fills in {name} placeholders from args, given
+// as alternating names and values. A "count" argument selects the plural
+// form. Unknown keys render as the key itself so that gaps are visible
+// without failing the email.
+func (tr *translator) translate(key string, args ...any) (string, error) {
+	params, err := dict(args...)
+	if err != nil {
+		return "", fmt.Errorf("t %q: %v", key, err)
+	}
+
+	for _, l := range tr.chain {
+		m, ok := tr.catalogs[l][key]
+		if !ok {
+			continue
+		}
+		text := m["other"]
+		if count, ok := params["count"]; ok {
+			if form, ok := m[pluralForm(l, toFloat(count))]; ok {
+				text = form
+			}
+		}
+		return interpolate(text, params), nil
+	}
+	return key, nil
+}
+
+// pluralForm returns the CLDR plural category of n for the language of
+// locale. Only the rules for the integer counts of common languages are
+// covered; everything else follows English.
+func pluralForm(locale string, n float64) string {
+	lang, _, _ := strings.Cut(locale, "-")
+	switch lang {
+	case "ja", "ko", "zh", "th", "vi", "id":
+		return "other"
+	case "fr", "pt":
+		if n == 0 || n == 1 {
+			return "one"
+		}
+	case "ar":
+		switch {
+		case n == 0:
+			return "zero"
+		case n == 1:
+			return "one"
+		case n == 2:
+			return "two"
+		case int(n)%100 >= 3 && int(n)%100 <= 10:
+			return "few"
+		case int(n)%100 >= 11:
+			return "many"
+		}
+	case "ru", "uk", "pl":
+		mod10, mod100 := int(n)%10, int(n)%100
+		switch {
+		case lang == "pl" && n == 1, lang != "pl" && mod10 == 1 && mod100 != 11:
+			return "one"
+		case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+			return "few"
+		default:
+			return "many"
+		}
+	default:
+		if n == 1 {
+			return "one"
+		}
+	}
+	return "other"
+}
+
+func toFloat(v any) float64 {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case float64:
+		return n
+	case string:
+		f, _ := strconv.ParseFloat(n, 64)
+		return f
+	default:
+		return 0
+	}
+}
+
+var placeholder = regexp.MustCompile(`\{(\w+)\}`)
+
+func interpolate(text string, params map[string]any) string {
+	return placeholder.ReplaceAllStringFunc(text, func(match string) string {
+		if value, ok := params[match[1:len(match)-1]]; ok {
+			return fmt.Sprint(value)
+		}
+		return match
+	})
+}
+
+// rtlLanguages are written right to left.
+var rtlLanguages = map[string]bool{
+	"ar": true, "fa": true, "he": true, "ps": true, "ur": true, "yi": true,
+}
+
+// direction returns the value for an HTML dir attribute.
+func (tr *translator) direction() string {
+	lang, _, _ := strings.Cut(tr.locale, "-")
+	if rtlLanguages[lang] {
+		return "rtl"
+	}
+	return "ltr"
+}
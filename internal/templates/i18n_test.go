@@ -0,0 +1,196 @@
+package templates
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPluralForm(t *testing.T) {
+	tests := []struct {
+		locale string
+		counts map[string][]float64
+	}{
+		{"en", map[string][]float64{"one": {1}, "other": {0, 2, 11, 21}}},
+		{"pt-br", map[string][]float64{"one": {0, 1}, "other": {2, 21}}},
+		{"ja", map[string][]float64{"other": {0, 1, 2}}},
+		{"ar", map[string][]float64{
+			"zero":  {0},
+			"one":   {1},
+			"two":   {2},
+			"few":   {3, 10, 103, 110},
+			"many":  {11, 26, 99, 111, 199},
+			"other": {100, 101, 102, 200},
+		}},
+		{"ru", map[string][]float64{
+			"one":  {1, 21, 101},
+			"few":  {2, 4, 22, 34, 102},
+			"many": {0, 5, 11, 12, 14, 19, 25, 111, 112},
+		}},
+		{"uk", map[string][]float64{"one": {1, 31}, "few": {3, 23}, "many": {11, 13, 20}}},
+		{"pl", map[string][]float64{
+			"one":  {1},
+			"few":  {2, 4, 22, 24, 102},
+			"many": {0, 5, 11, 12, 14, 21, 25, 112},
+		}},
+	}
+	for _, tt := range tests {
+		for want, counts := range tt.counts {
+			for _, n := range counts {
+				if got := pluralForm(tt.locale, n); got != want {
+					t.Errorf("pluralForm(%q, %v) = %q, want %q", tt.locale, n, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestLocaleChain(t *testing.T) {
+	tests := map[string][]string{
+		"pt-BR":      {"pt-br", "pt"},
+		"pt_br":      {"pt-br", "pt"},
+		"zh-Hant-TW": {"zh-hant-tw", "zh-hant", "zh"},
+		"en":         {"en"},
+		"":           nil,
+	}
+	for locale, want := range tests {
+		if got := localeChain(locale); !reflect.DeepEqual(got, want) {
+			t.Errorf("localeChain(%q) = %q, want %q", locale, got, want)
+		}
+	}
+}
+
+func testCatalogs(t *testing.T, sources map[string]string) map[string]catalog {
+	t.Helper()
+	catalogs := make(map[string]catalog)
+	for locale, source := range sources {
+		c, err := parseCatalog([]byte(source))
+		if err != nil {
+			t.Fatalf("%s: %v", locale, err)
+		}
+		catalogs[locale] = c
+	}
+	return catalogs
+}
+
+func TestTranslate(t *testing.T) {
+	catalogs := testCatalogs(t, map[string]string{
+		"en": `
+greeting: Hello {name}
+farewell: Goodbye
+only: English only
+hours:
+  one: "{count} hour"
+  other: "{count} hours"
+`,
+		"pt": `
+greeting: Olá {name}
+farewell: Adeus
+hours:
+  one: "{count} hora"
+  other: "{count} horas"
+`,
+		"pt-br": `
+farewell: Tchau
+`,
+		"ar": `
+greeting: مرحبا {name}
+`,
+	})
+
+	tests := []struct {
+		locale string
+		key    string
+		args   []any
+		want   string
+	}{
+		{"pt-BR", "farewell", nil, "Tchau"},
+		{"pt-BR", "greeting", []any{"name", "Ana"}, "Olá Ana"},
+		{"pt-BR", "only", nil, "English only"},
+		{"pt-BR", "missing.key", nil, "missing.key"},
+		{"pt-BR", "hours", []any{"count", 0}, "0 hora"},
+		{"pt-BR", "hours", []any{"count", 2}, "2 horas"},
+		{"en", "hours", []any{"count", 1}, "1 hour"},
+		{"en", "hours", []any{"count", 1.0}, "1 hour"},
+		{"en", "hours", []any{"count", "3"}, "3 hours"},
+		{"en", "greeting", nil, "Hello {name}"},
+		{"fr", "greeting", []any{"name", "Zoé", "unused", 1}, "Hello Zoé"},
+	}
+	for _, tt := range tests {
+		got, err := newTranslator(catalogs, tt.locale).translate(tt.key, tt.args...)
+		if err != nil {
+			t.Errorf("translate(%q, %q) failed: %v", tt.locale, tt.key, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("translate(%q, %q) = %q, want %q", tt.locale, tt.key, got, tt.want)
+		}
+	}
+
+	if _, err := newTranslator(catalogs, "en").translate("greeting", "name"); err == nil {
+		t.Error("translate with an odd number of arguments succeeded")
+	}
+
+	// The direction follows the catalog in use, so Hebrew without a
+	// catalog of its own is English, left to right.
+	directions := map[string]string{"ar-EG": "rtl", "ar": "rtl", "pt-BR": "ltr", "en": "ltr", "he": "ltr"}
+	for locale, want := range directions {
+		if got := newTranslator(catalogs, locale).direction(); got != want {
+			t.Errorf("direction for %q = %q, want %q", locale, got, want)
+		}
+	}
+}
+
+// writeFiles creates files under dir from a map of slash-separated paths
+// to contents.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLocaleOverrideMergesWithBuiltin(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"_locales/pt.yaml":   "confirmation:\n  heading: Olá de novo!\n",
+		"greeting/text.tmpl": `{{t "confirmation.heading"}}|{{t "confirmation.subtitle"}}|{{t "common.team"}}|{{locale}}|{{dir}}`,
+	})
+
+	r := NewRegistry()
+	if err := r.Load(dir); err != nil {
+		t.Fatal(err)
+	}
+	tmpl, ok := r.Lookup("greeting")
+	if !ok {
+		t.Fatal("greeting was not loaded")
+	}
+
+	tests := map[string]string{
+		"pt":    "Olá de novo!|A sua jornada de aprendizagem começa aqui|A Equipa Aptiverse|pt|ltr",
+		"pt-BR": "Olá de novo!|A sua jornada de aprendizagem começa aqui|Equipe Aptiverse|pt-BR|ltr",
+		"en":    "Welcome to Aptiverse!|Your learning journey begins here|The Aptiverse Team|en|ltr",
+	}
+	for locale, want := range tests {
+		rendered, err := tmpl.Render(map[string]any{}, RenderOptions{Locale: locale})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rendered.Text != want {
+			t.Errorf("%s rendered %q, want %q", locale, rendered.Text, want)
+		}
+	}
+
+	// The override applies to the directory's templates only.
+	builtin, _ := Lookup("email_confirmation")
+	if got, _ := newTranslator(builtin.catalogs, "pt").translate("confirmation.heading"); got != "Bem-vindo à Aptiverse!" {
+		t.Errorf("built-in pt heading is %q after loading an override", got)
+	}
+}
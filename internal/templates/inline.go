@@ -0,0 +1,410 @@
+package templates
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// InlineCSS moves the rules of an HTML document's <style> blocks into
+// style attributes, since Gmail and Outlook ignore or strip most <style>
+// content. @media, @font-face and other at-rules that cannot be inlined are
+// kept in a single <style> block in the head. @import rules and selectors
+// with dynamic pseudo-classes or pseudo-elements are dropped. The returned
+// list describes every rule that was kept or dropped instead of inlined.
+func InlineCSS(source string) (string, []string, error) {
+	doc, err := html.Parse(strings.NewReader(source))
+	if err != nil {
+		return "", nil, err
+	}
+
+	var sheets []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Style {
+			sheets = append(sheets, n)
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	if len(sheets) == 0 {
+		return source, nil, nil
+	}
+
+	var rules []cssRule
+	var kept []string
+	var report []string
+	for _, sheet := range sheets {
+		var css strings.Builder
+		for c := sheet.FirstChild; c != nil; c = c.NextSibling {
+			css.WriteString(c.Data)
+		}
+		r, k, rep := parseStylesheet(css.String(), len(rules))
+		rules = append(rules, r...)
+		kept = append(kept, k...)
+		report = append(report, rep...)
+		sheet.Parent.RemoveChild(sheet)
+	}
+
+	applyRules(doc, rules)
+
+	if len(kept) > 0 {
+		if head := findElement(doc, atom.Head); head != nil {
+			style := &html.Node{Type: html.ElementNode, DataAtom: atom.Style, Data: "style"}
+			style.AppendChild(&html.Node{Type: html.TextNode, Data: "\n" + strings.Join(kept, "\n") + "\n"})
+			head.AppendChild(style)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, doc); err != nil {
+		return "", nil, err
+	}
+	return buf.String(), report, nil
+}
+
+type cssDeclaration struct {
+	property  string
+	value     string
+	important bool
+}
+
+// cssRule is one selector of a style rule, so a rule with a selector list
+// becomes several cssRules sharing the same declarations.
+type cssRule struct {
+	selector     selector
+	specificity  [3]int
+	order        int
+	declarations []cssDeclaration
+}
+
+var cssComment = regexp.MustCompile(`(?s)/\*.*?\*/`)
+
+// parseStylesheet splits css into inlinable rules, at-rules to keep in the
+// head, and a report of everything that was not inlined.
+func parseStylesheet(css string, order int) ([]cssRule, []string, []string) {
+	css = cssComment.ReplaceAllString(css, "")
+
+	var rules []cssRule
+	var kept, report []string
+	for _, block := range splitBlocks(css) {
+		prelude, body := block[0], block[1]
+		if strings.HasPrefix(prelude, "@") {
+			name := strings.ToLower(strings.Fields(prelude)[0])
+			switch name {
+			case "@import", "@charset", "@namespace":
+				report = append(report, fmt.Sprintf("%s: dropped, email clients do not load external stylesheets", prelude))
+			default:
+				kept = append(kept, prelude+" {"+body+"}")
+				report = append(report, fmt.Sprintf("%s: kept in <head>, at-rules cannot be inlined", prelude))
+			}
+			continue
+		}
+
+		declarations := parseDeclarations(body)
+		for _, source := range splitSelectors(prelude) {
+			source = strings.TrimSpace(source)
+			if source == "" {
+				continue
+			}
+			sel, err := parseSelector(source)
+			if err != nil {
+				report = append(report, fmt.Sprintf("%s: dropped, %v", source, err))
+				continue
+			}
+			rules = append(rules, cssRule{
+				selector:     sel,
+				specificity:  sel.specificity(),
+				order:        order,
+				declarations: declarations,
+			})
+			order++
+		}
+	}
+	return rules, kept, report
+}
+
+// splitBlocks returns the prelude and body of each top-level block in css.
+// Statements without a body, such as @import, get an empty body.
+func splitBlocks(css string) [][2]string {
+	var blocks [][2]string
+	var quote byte
+	depth, start, bodyStart := 0, 0, 0
+	for i := 0; i < len(css); i++ {
+		c := css[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '{':
+			if depth == 0 {
+				bodyStart = i + 1
+			}
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				prelude := strings.TrimSpace(css[start : bodyStart-1])
+				blocks = append(blocks, [2]string{prelude, css[bodyStart:i]})
+				start = i + 1
+			}
+		case c == ';' && depth == 0:
+			if prelude := strings.TrimSpace(css[start:i]); prelude != "" {
+				blocks = append(blocks, [2]string{prelude, ""})
+			}
+			start = i + 1
+		}
+	}
+	return blocks
+}
+
+// splitSelectors splits a selector list on the commas that are outside
+// brackets, parentheses and quotes, so that a[title="x,y"] stays whole.
+func splitSelectors(prelude string) []string {
+	var selectors []string
+	var quote byte
+	depth, start := 0, 0
+	for i := 0; i < len(prelude); i++ {
+		c := prelude[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+		case c == ',' && depth == 0:
+			selectors = append(selectors, prelude[start:i])
+			start = i + 1
+		}
+	}
+	return append(selectors, prelude[start:])
+}
+
+// parseDeclarations splits a declaration block on semicolons outside
+// quotes and parentheses, so data URLs survive.
+func parseDeclarations(body string) []cssDeclaration {
+	var declarations []cssDeclaration
+	var quote byte
+	depth, start := 0, 0
+	add := func(s string) {
+		property, value, ok := strings.Cut(s, ":")
+		property = strings.ToLower(strings.TrimSpace(property))
+		value = strings.TrimSpace(value)
+		if !ok || property == "" || value == "" {
+			return
+		}
+		important := false
+		if i := strings.LastIndex(strings.ToLower(value), "!important"); i >= 0 {
+			important = true
+			value = strings.TrimSpace(value[:i])
+		}
+		declarations = append(declarations, cssDeclaration{property: property, value: value, important: important})
+	}
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ';' && depth == 0:
+			add(body[start:i])
+			start = i + 1
+		}
+	}
+	add(body[start:])
+	return declarations
+}
+
+// unrendered lists the elements whose content is never displayed, so
+// rules are not applied to them or anything inside them.
+var unrendered = map[atom.Atom]bool{
+	atom.Head:     true,
+	atom.Title:    true,
+	atom.Meta:     true,
+	atom.Link:     true,
+	atom.Base:     true,
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Template: true,
+	atom.Noscript: true,
+}
+
+// applyRules sets the style attribute of every element matched by rules.
+// Declarations apply in order of specificity, then source order, with
+// !important ones last and the element's own style attribute winning over
+// everything that is not !important. Elements that are never rendered are
+// left alone.
+func applyRules(doc *html.Node, rules []cssRule) {
+	sort.SliceStable(rules, func(i, j int) bool {
+		a, b := rules[i], rules[j]
+		if a.specificity != b.specificity {
+			for k := range a.specificity {
+				if a.specificity[k] != b.specificity[k] {
+					return a.specificity[k] < b.specificity[k]
+				}
+			}
+		}
+		return a.order < b.order
+	})
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && unrendered[n.DataAtom] {
+			return
+		}
+		if n.Type == html.ElementNode {
+			var style styleMap
+			for _, important := range []bool{false, true} {
+				for _, rule := range rules {
+					if !rule.selector.matches(n) {
+						continue
+					}
+					for _, d := range rule.declarations {
+						if d.important == important {
+							style.set(d.property, d.value, important)
+						}
+					}
+				}
+				if !important {
+					for _, d := range parseDeclarations(attr(n, "style")) {
+						style.set(d.property, d.value, false)
+					}
+				}
+			}
+			if len(style.properties) > 0 {
+				setAttr(n, "style", style.String())
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+}
+
+// styleMap keeps declarations in the order their properties first appear.
+type styleMap struct {
+	properties []string
+	values     map[string]string
+	important  map[string]bool
+	// derived is set while background-color holds the fallback colour of a
+	// gradient rather than a declaration of its own.
+	derived bool
+}
+
+func (s *styleMap) set(property, value string, important bool) {
+	if s.values == nil {
+		s.values = make(map[string]string)
+		s.important = make(map[string]bool)
+	}
+	if _, ok := s.values[property]; !ok {
+		s.properties = append(s.properties, property)
+	} else if s.important[property] && !important {
+		return
+	}
+	s.values[property] = value
+	s.important[property] = important
+
+	switch property {
+	case "background-color":
+		s.derived = false
+	case "background", "background-image":
+		// Outlook ignores gradients, so give it the first colour stop. The
+		// fallback follows the background that was set last and never
+		// replaces a background-color that was declared.
+		if s.derived {
+			s.remove("background-color")
+		}
+		if _, ok := s.values["background-color"]; ok {
+			return
+		}
+		if color := gradientFallback(value); color != "" {
+			s.properties = append(s.properties, "background-color")
+			s.values["background-color"] = color
+			s.important["background-color"] = important
+			s.derived = true
+		}
+	}
+}
+
+func (s *styleMap) remove(property string) {
+	for i, p := range s.properties {
+		if p == property {
+			s.properties = append(s.properties[:i], s.properties[i+1:]...)
+			break
+		}
+	}
+	delete(s.values, property)
+	delete(s.important, property)
+	if property == "background-color" {
+		s.derived = false
+	}
+}
+
+func (s *styleMap) String() string {
+	parts := make([]string, len(s.properties))
+	for i, property := range s.properties {
+		parts[i] = property + ": " + s.values[property]
+	}
+	return strings.Join(parts, "; ")
+}
+
+var gradientColor = regexp.MustCompile(`gradient\([^#]*?(#[0-9a-fA-F]{3,8}|rgba?\([^)]*\))`)
+
+func gradientFallback(value string) string {
+	if m := gradientColor.FindStringSubmatch(value); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func setAttr(n *html.Node, key, value string) {
+	for i := range n.Attr {
+		if n.Attr[i].Key == key {
+			n.Attr[i].Val = value
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: value})
+}
@@ -0,0 +1,162 @@
+package templates
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// inlineStyles inlines css into body and returns the style attribute of
+// every element with an id.
+func inlineStyles(t *testing.T, css, body string) (map[string]string, string, []string) {
+	t.Helper()
+	out, report, err := InlineCSS("<html><head><style>" + css + "</style></head><body>" + body + "</body></html>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := html.Parse(strings.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	styles := make(map[string]string)
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if id := attr(n, "id"); n.Type == html.ElementNode && id != "" {
+			styles[id] = attr(n, "style")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return styles, out, report
+}
+
+func TestInlineCSS(t *testing.T) {
+	tests := []struct {
+		name string
+		css  string
+		body string
+		want map[string]string
+	}{
+		{
+			name: "specificity beats source order",
+			css:  "#x { color: red } p.a { color: blue } p { color: green }",
+			body: `<p id="x" class="a"></p>`,
+			want: map[string]string{"x": "color: red"},
+		},
+		{
+			name: "later rule wins at equal specificity",
+			css:  ".a { color: red } .b { color: blue }",
+			body: `<p id="x" class="b a"></p>`,
+			want: map[string]string{"x": "color: blue"},
+		},
+		{
+			name: "own style beats rules",
+			css:  "#x { color: red; margin: 0 }",
+			body: `<p id="x" style="color: blue"></p>`,
+			want: map[string]string{"x": "color: blue; margin: 0"},
+		},
+		{
+			name: "important beats own style",
+			css:  "p { color: red !important } #x { color: green }",
+			body: `<p id="x" style="color: blue"></p>`,
+			want: map[string]string{"x": "color: red"},
+		},
+		{
+			name: "child and descendant combinators",
+			css:  "div > span { color: red } div em { color: blue }",
+			body: `<div><span id="child"><em id="deep"><span id="grandchild"></span></em></span></div>`,
+			want: map[string]string{"child": "color: red", "deep": "color: blue", "grandchild": ""},
+		},
+		{
+			name: "comma inside an attribute value",
+			css:  `a[title="x,y"], p { color: red }`,
+			body: `<a id="a" title="x,y"></a><a id="other" title="x"></a><p id="p"></p>`,
+			want: map[string]string{"a": "color: red", "other": "", "p": "color: red"},
+		},
+		{
+			name: "gradient gets a fallback colour",
+			css:  ".a { background: linear-gradient(#111, #222) }",
+			body: `<div id="x" class="a"></div>`,
+			want: map[string]string{"x": "background: linear-gradient(#111, #222); background-color: #111"},
+		},
+		{
+			name: "plain background replaces the gradient fallback",
+			css:  ".a { background: linear-gradient(#111, #222) } div.a { background: #fff }",
+			body: `<div id="x" class="a"></div>`,
+			want: map[string]string{"x": "background: #fff"},
+		},
+		{
+			name: "fallback follows the last gradient",
+			css:  ".a { background-image: linear-gradient(#111, #222) } div.a { background-image: linear-gradient(#333, #444) }",
+			body: `<div id="x" class="a"></div>`,
+			want: map[string]string{"x": "background-image: linear-gradient(#333, #444); background-color: #333"},
+		},
+		{
+			name: "fallback never replaces a declared colour",
+			css:  ".a { background-color: #fff } div.a { background: linear-gradient(#111, #222) }",
+			body: `<div id="x" class="a"></div>`,
+			want: map[string]string{"x": "background-color: #fff; background: linear-gradient(#111, #222)"},
+		},
+		{
+			name: "declared colour replaces the fallback",
+			css:  ".a { background: linear-gradient(#111, #222) }",
+			body: `<div id="x" class="a" style="background-color: #fff"></div>`,
+			want: map[string]string{"x": "background: linear-gradient(#111, #222); background-color: #fff"},
+		},
+		{
+			name: "unrendered elements are left alone",
+			css:  "* { margin: 0 }",
+			body: `<p id="x"></p><script id="script"></script><noscript id="noscript"></noscript><template id="template"><p id="inside"></p></template>`,
+			want: map[string]string{"x": "margin: 0", "script": "", "noscript": "", "template": "", "inside": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			styles, _, _ := inlineStyles(t, tt.css, tt.body)
+			for id, want := range tt.want {
+				if got := styles[id]; got != want {
+					t.Errorf("#%s style = %q, want %q", id, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestInlineCSSReportsWhatIsNotInlined(t *testing.T) {
+	css := `@media (max-width: 600px) { .a { width: 100% } }
+		a:hover { color: red }
+		p::before { content: "x" }
+		p { color: blue }`
+	styles, out, report := inlineStyles(t, css, `<p id="x" class="a"></p><a id="a"></a>`)
+
+	if styles["x"] != "color: blue" || styles["a"] != "" {
+		t.Errorf("styles = %v", styles)
+	}
+	doc, err := html.Parse(strings.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	style := findElement(findElement(doc, atom.Head), atom.Style)
+	if style == nil || !strings.Contains(style.FirstChild.Data, "@media (max-width: 600px) { .a { width: 100% } }") {
+		t.Errorf("media query not kept in the head:\n%s", out)
+	}
+	if strings.Contains(out, "hover") || strings.Contains(out, "before") {
+		t.Errorf("dynamic selectors were not dropped:\n%s", out)
+	}
+
+	for _, want := range []string{"@media (max-width: 600px): kept", "a:hover: dropped", "p::before: dropped"} {
+		found := false
+		for _, line := range report {
+			if strings.HasPrefix(line, want) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("report %q has no line starting with %q", report, want)
+		}
+	}
+}
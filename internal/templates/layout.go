@@ -0,0 +1,174 @@
+package templates
+
+import (
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// funcs are available to every template, layout and partial.
+var funcs = map[string]any{
+	"dict": dict,
+	"list": list,
+	"now":  time.Now,
+	// The functions below are placeholders, bound for each email when it
+	// is rendered.
+	"subject": func() string { return "" },
+	"t":       func(key string, args ...any) (string, error) { return key, nil },
+	"locale":  func() string { return defaultLocale },
+	"dir":     func() string { return "ltr" },
+}
+
+// dict builds a map from alternating keys and values so that partials can
+// take named arguments, e.g. {{template "button" dict "URL" .Link "Label" "Go"}}.
+func dict(pairs ...any) (map[string]any, error) {
+	if len(pairs)%2 != 0 {
+		return nil, errors.New("dict needs an even number of arguments")
+	}
+	m := make(map[string]any, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict key %v is not a string", pairs[i])
+		}
+		m[key] = pairs[i+1]
+	}
+	return m, nil
+}
+
+func list(items ...any) []any {
+	return items
+}
+
+// shared holds the layouts, partials and message catalogs that templates
+// are parsed on top of. Each template gets its own clone, so its {{define}}
+// overrides of a layout's {{block}}s do not leak into other templates.
+type shared struct {
+	html     *htmltemplate.Template
+	text     *texttemplate.Template
+	catalogs map[string]catalog
+}
+
+// builtinShared holds the layouts, partials and catalogs embedded in the
+// binary.
+var builtinShared = &shared{
+	html:     htmltemplate.New("").Funcs(funcs),
+	text:     texttemplate.New("").Funcs(funcs),
+	catalogs: make(map[string]catalog),
+}
+
+func (s *shared) clone() (*shared, error) {
+	html, err := s.html.Clone()
+	if err != nil {
+		return nil, err
+	}
+	text, err := s.text.Clone()
+	if err != nil {
+		return nil, err
+	}
+	catalogs := make(map[string]catalog, len(s.catalogs))
+	for locale, c := range s.catalogs {
+		catalogs[locale] = make(catalog, len(c))
+		for key, m := range c {
+			catalogs[locale][key] = m
+		}
+	}
+	return &shared{html: html, text: text, catalogs: catalogs}, nil
+}
+
+// loadShared adds the files in the _layouts, _partials and _locales
+// directories of fsys to a copy of base. A file named button.html.tmpl
+// defines the HTML template "button", and button.text.tmpl its plain-text
+// counterpart. A catalog such as _locales/pt-BR.yaml adds to, and overrides
+// keys of, any built-in catalog for the same locale.
+func loadShared(fsys fs.FS, base *shared) (*shared, error) {
+	s, err := base.clone()
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, dir := range []string{"_layouts", "_partials"} {
+		entries, err := fs.ReadDir(fsys, dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, entry := range entries {
+			file := path.Join(dir, entry.Name())
+			data, err := fs.ReadFile(fsys, file)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			// Drop the file's final newline so that including a partial on
+			// a line of its own does not add a blank line after it.
+			content := strings.TrimSuffix(string(data), "\n")
+			switch {
+			case strings.HasSuffix(entry.Name(), ".html.tmpl"):
+				_, err = s.html.New(strings.TrimSuffix(entry.Name(), ".html.tmpl")).Parse(content)
+			case strings.HasSuffix(entry.Name(), ".text.tmpl"):
+				_, err = s.text.New(strings.TrimSuffix(entry.Name(), ".text.tmpl")).Parse(content)
+			default:
+				err = errors.New("expected a .html.tmpl or .text.tmpl file")
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", file, err))
+			}
+		}
+	}
+	if err := s.loadCatalogs(fsys); err != nil {
+		errs = append(errs, err)
+	}
+	return s, errors.Join(errs...)
+}
+
+func (s *shared) loadCatalogs(fsys fs.FS) error {
+	entries, err := fs.ReadDir(fsys, "_locales")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, entry := range entries {
+		file := path.Join("_locales", entry.Name())
+		ext := path.Ext(entry.Name())
+		if ext != ".json" && ext != ".yaml" && ext != ".yml" {
+			errs = append(errs, fmt.Errorf("%s: expected a .json, .yaml or .yml file", file))
+			continue
+		}
+
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		c, err := parseCatalog(data)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", file, err))
+			continue
+		}
+
+		locale := normalizeLocale(strings.TrimSuffix(entry.Name(), ext))
+		if s.catalogs[locale] == nil {
+			s.catalogs[locale] = make(catalog, len(c))
+		}
+		for key, m := range c {
+			s.catalogs[locale][key] = m
+		}
+	}
+	return errors.Join(errs...)
+}
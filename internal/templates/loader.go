@@ -0,0 +1,234 @@
+package templates
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// builtinFS holds the templates that ship with the service, laid out the
+// same way as a template directory.
+//
+//go:embed all:builtin
+var builtinFS embed.FS
+
+func init() {
+	builtin, err := fs.Sub(builtinFS, "builtin")
+	if err != nil {
+		panic(err)
+	}
+	builtinShared, err = loadShared(builtin, builtinShared)
+	if err != nil {
+		panic(err)
+	}
+	loaded, err := loadFS(builtin, builtinShared)
+	if err != nil {
+		panic(err)
+	}
+	for _, t := range loaded {
+		if err := Register(*t); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// meta is the optional meta.yaml file of a template directory.
+type meta struct {
+	Required []string `yaml:"required"`
+	Layout   string   `yaml:"layout"`
+}
+
+// loadFS parses every template in fsys on top of the layouts and partials in
+// s. Each subdirectory is one template named after the directory, holding
+// any of subject.tmpl, html.tmpl, text.tmpl, meta.yaml and sample data in
+// fixtures/<name>.json; directories starting with an underscore hold
+// layouts and partials instead. Errors are collected for every file rather
+// than stopping at the first.
+func loadFS(fsys fs.FS, s *shared) (map[string]*Template, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	loaded := make(map[string]*Template)
+	var errs []error
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), "_") {
+			continue
+		}
+		t, err := loadTemplate(fsys, entry.Name(), s)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		loaded[t.Name] = t
+	}
+	return loaded, errors.Join(errs...)
+}
+
+func loadTemplate(fsys fs.FS, name string, s *shared) (*Template, error) {
+	t := &Template{Name: name}
+	var errs []error
+
+	read := func(file string) string {
+		data, err := fs.ReadFile(fsys, path.Join(name, file))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+		}
+		return string(data)
+	}
+	t.Subject = read("subject.tmpl")
+	t.HTML = read("html.tmpl")
+	t.Text = read("text.tmpl")
+	t.Schema = read("schema.json")
+
+	localized, err := fs.Glob(fsys, path.Join(name, "subject.*.tmpl"))
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, file := range localized {
+		locale := strings.TrimSuffix(strings.TrimPrefix(path.Base(file), "subject."), ".tmpl")
+		if t.Subjects == nil {
+			t.Subjects = make(map[string]string)
+		}
+		t.Subjects[locale] = read(path.Base(file))
+	}
+
+	fixtures, err := fs.Glob(fsys, path.Join(name, "fixtures", "*.json"))
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, file := range fixtures {
+		var data map[string]any
+		if err := json.Unmarshal([]byte(read(path.Join("fixtures", path.Base(file)))), &data); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", file, err))
+			continue
+		}
+		if t.Fixtures == nil {
+			t.Fixtures = make(map[string]map[string]any)
+		}
+		t.Fixtures[strings.TrimSuffix(path.Base(file), ".json")] = data
+	}
+
+	if data := read("meta.yaml"); data != "" {
+		var m meta
+		if err := yaml.Unmarshal([]byte(data), &m); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", path.Join(name, "meta.yaml"), err))
+		}
+		t.Required = m.Required
+		t.Layout = m.Layout
+	}
+
+	if t.HTML == "" && t.Text == "" {
+		errs = append(errs, fmt.Errorf("%s: needs html.tmpl or text.tmpl", name))
+	} else if err := t.parse(s); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return t, nil
+}
+
+// Load parses the templates in dir and swaps them in as a set. Layouts and
+// partials in dir are added to the built-in ones, replacing any with the
+// same name. If any file fails to parse, the previously loaded templates
+// stay in use.
+func (r *Registry) Load(dir string) error {
+	loaded, err := loadDir(dir)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err == nil {
+		r.loaded = loaded
+	}
+	r.loadErr = err
+	if r.changed != nil {
+		close(r.changed)
+		r.changed = nil
+	}
+	return err
+}
+
+func loadDir(dir string) (map[string]*Template, error) {
+	fsys := os.DirFS(dir)
+	s, err := loadShared(fsys, builtinShared)
+	if err != nil {
+		return nil, err
+	}
+	return loadFS(fsys, s)
+}
+
+// Watch reloads dir whenever its files change, checking every interval, or
+// when reload receives a value, until ctx is done. Failed reloads are logged
+// and keep the current templates.
+func (r *Registry) Watch(ctx context.Context, dir string, interval time.Duration, reload <-chan os.Signal) {
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	last, _ := fingerprint(dir)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-reload:
+			log.Printf("Reloading templates from %s", dir)
+		case <-tick:
+			current, err := fingerprint(dir)
+			if err != nil || current == last {
+				continue
+			}
+			log.Printf("Templates in %s changed, reloading", dir)
+		}
+
+		last, _ = fingerprint(dir)
+		if err := r.Load(dir); err != nil {
+			log.Printf("Failed to reload templates, keeping the previous set: %v", err)
+			continue
+		}
+		log.Printf("Loaded templates: %v", r.Names())
+	}
+}
+
+// fingerprint summarises the names, sizes and modification times of every
+// file under dir so that changes can be detected without reading them.
+func fingerprint(dir string) (uint64, error) {
+	h := fnv.New64a()
+	err := fs.WalkDir(os.DirFS(dir), ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00%d\x00", p, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	return h.Sum64(), err
+}
+
+// Load replaces the directory templates of the default registry.
+func Load(dir string) error {
+	return defaultRegistry.Load(dir)
+}
+
+// Watch keeps the default registry in sync with dir.
+func Watch(ctx context.Context, dir string, interval time.Duration, reload <-chan os.Signal) {
+	defaultRegistry.Watch(ctx, dir, interval, reload)
+}
@@ -0,0 +1,114 @@
+package templates
+
+import (
+	"strings"
+	"testing"
+)
+
+func renderText(t *testing.T, r *Registry, name string) string {
+	t.Helper()
+	tmpl, ok := r.Lookup(name)
+	if !ok {
+		t.Fatalf("template %q is not loaded", name)
+	}
+	rendered, err := tmpl.Render(map[string]any{}, RenderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rendered.Text
+}
+
+func TestLoadKeepsPreviousSetOnError(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"_layouts/page.text.tmpl": `[{{block "title" .}}Default title{{end}}] {{block "content" .}}{{end}}`,
+		"a/meta.yaml":             "layout: page\n",
+		"a/text.tmpl":             `{{define "title"}}A title{{end}}{{define "content"}}A body{{end}}`,
+		"b/meta.yaml":             "layout: page\n",
+		"b/text.tmpl":             `{{define "content"}}B body{{end}}`,
+	})
+
+	r := NewRegistry()
+	changed := r.Changed()
+	if err := r.Load(dir); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+	default:
+		t.Error("Changed was not closed by a load")
+	}
+
+	if got := renderText(t, r, "a"); got != "[A title] A body" {
+		t.Errorf("a rendered %q", got)
+	}
+	// a's title block must not leak into b, which shares the layout.
+	if got := renderText(t, r, "b"); got != "[Default title] B body" {
+		t.Errorf("b rendered %q", got)
+	}
+
+	writeFiles(t, dir, map[string]string{
+		"a/text.tmpl": `{{define "content"}}{{.Broken`,
+		"b/meta.yaml": "layout: [page\n",
+		"c/text.tmpl": "New template",
+	})
+	changed = r.Changed()
+	err := r.Load(dir)
+	if err == nil {
+		t.Fatal("Load succeeded with broken files")
+	}
+	<-changed
+
+	for _, file := range []string{"a/text.tmpl", "b/meta.yaml"} {
+		if !strings.Contains(r.LoadError().Error(), file) {
+			t.Errorf("LoadError() = %q, want it to name %s", r.LoadError(), file)
+		}
+	}
+	if got := renderText(t, r, "a"); got != "[A title] A body" {
+		t.Errorf("a rendered %q after a failed reload, want the previous template", got)
+	}
+	if _, ok := r.Lookup("c"); ok {
+		t.Error("a failed reload added part of the new set")
+	}
+
+	writeFiles(t, dir, map[string]string{
+		"a/text.tmpl": `{{define "content"}}A fixed{{end}}`,
+		"b/meta.yaml": "layout: page\n",
+	})
+	if err := r.Load(dir); err != nil {
+		t.Fatal(err)
+	}
+	if r.LoadError() != nil {
+		t.Errorf("LoadError() = %v after a successful reload", r.LoadError())
+	}
+	if got := renderText(t, r, "a"); got != "[Default title] A fixed" {
+		t.Errorf("a rendered %q after the fix", got)
+	}
+	if got := renderText(t, r, "c"); got != "New template" {
+		t.Errorf("c rendered %q", got)
+	}
+}
+
+func TestLoadedTemplatesOverrideBuiltins(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"email_confirmation/text.tmpl": "Custom confirmation",
+	})
+
+	r := NewRegistry()
+	if err := r.Register(Template{Name: "email_confirmation", Text: "Built-in confirmation"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := renderText(t, r, "email_confirmation"); got != "Built-in confirmation" {
+		t.Errorf("rendered %q before loading", got)
+	}
+	if err := r.Load(dir); err != nil {
+		t.Fatal(err)
+	}
+	if got := renderText(t, r, "email_confirmation"); got != "Custom confirmation" {
+		t.Errorf("rendered %q after loading", got)
+	}
+	if names := r.Names(); len(names) != 1 {
+		t.Errorf("Names() = %v, want the name once", names)
+	}
+}
@@ -0,0 +1,37 @@
+package templates
+
+import "strings"
+
+// normalizeLocale lower-cases a locale and uses "-" as the separator, so
+// that "pt_BR", "pt-BR" and "pt-br" all match.
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+// languageTag formats a normalized locale for an HTML lang attribute, with
+// the region in upper case: "pt-br" gives "pt-BR".
+func languageTag(locale string) string {
+	parts := strings.Split(locale, "-")
+	for i := 1; i < len(parts); i++ {
+		if len(parts[i]) == 2 {
+			parts[i] = strings.ToUpper(parts[i])
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// localeChain lists the locales to try for locale, most specific first:
+// "pt-BR" gives "pt-br" then "pt".
+func localeChain(locale string) []string {
+	locale = normalizeLocale(locale)
+	var chain []string
+	for locale != "" {
+		chain = append(chain, locale)
+		i := strings.LastIndex(locale, "-")
+		if i < 0 {
+			break
+		}
+		locale = locale[:i]
+	}
+	return chain
+}
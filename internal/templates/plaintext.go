@@ -0,0 +1,275 @@
+package templates
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// textWidth is the column plain-text bodies are wrapped at.
+const textWidth = 78
+
+// cellSeparator goes between the cells of a flattened table row.
+const cellSeparator = "  "
+
+// HTMLToText derives a readable plain-text body from rendered HTML for
+// templates without a text variant. Headings are underlined, list items
+// get bullets or numbers, links are written as "text (url)", table rows
+// become lines, and head, style and script content is dropped.
+func HTMLToText(source string) string {
+	doc, err := html.Parse(strings.NewReader(source))
+	if err != nil {
+		return ""
+	}
+	w := &textWriter{}
+	w.walk(doc)
+	w.flush(0)
+	return strings.TrimSpace(w.out.String()) + "\n"
+}
+
+type listState struct {
+	ordered bool
+	next    int
+}
+
+type textWriter struct {
+	out     strings.Builder
+	line    strings.Builder
+	pending int
+	pre     int
+	lists   []listState
+	// bullet is written before the first line of the next flushed block.
+	bullet string
+}
+
+func (w *textWriter) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.text(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			w.walk(c)
+		}
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Head, atom.Style, atom.Script, atom.Noscript, atom.Template:
+		return
+	case atom.Br:
+		w.flush(1)
+		return
+	case atom.Hr:
+		w.flush(2)
+		w.write(strings.Repeat("-", textWidth))
+		w.flush(2)
+		return
+	case atom.Img:
+		if alt := attr(n, "alt"); alt != "" {
+			w.text(alt)
+		}
+		return
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		w.flush(2)
+		w.children(n)
+		heading := strings.TrimSpace(w.line.String())
+		w.line.Reset()
+		if heading != "" {
+			underline := "-"
+			if n.DataAtom == atom.H1 {
+				underline = "="
+			}
+			w.write(heading)
+			w.flush(1)
+			w.write(strings.Repeat(underline, min(utf8.RuneCountInString(heading), textWidth)))
+		}
+		w.flush(2)
+		return
+	case atom.A:
+		start := w.line.Len()
+		w.children(n)
+		href := strings.TrimSpace(attr(n, "href"))
+		var label string
+		if w.line.Len() >= start {
+			label = strings.TrimSpace(w.line.String()[start:])
+		}
+		if href != "" && href != label && !strings.HasPrefix(href, "#") && !strings.HasPrefix(href, "javascript:") {
+			if label == "" {
+				w.text(href)
+			} else {
+				w.text(" (" + href + ")")
+			}
+		}
+		return
+	case atom.Ul, atom.Ol:
+		w.flush(blockGap(len(w.lists)))
+		w.lists = append(w.lists, listState{ordered: n.DataAtom == atom.Ol, next: 1})
+		w.children(n)
+		w.lists = w.lists[:len(w.lists)-1]
+		w.flush(blockGap(len(w.lists)))
+		return
+	case atom.Li:
+		w.flush(1)
+		if len(w.lists) > 0 {
+			list := &w.lists[len(w.lists)-1]
+			w.bullet = "* "
+			if list.ordered {
+				w.bullet = strconv.Itoa(list.next) + ". "
+				list.next++
+			}
+		}
+		w.children(n)
+		w.flush(1)
+		return
+	case atom.Pre:
+		w.flush(2)
+		w.pre++
+		w.children(n)
+		w.flush(2)
+		w.pre--
+		return
+	case atom.Td, atom.Th:
+		if line := strings.TrimRight(w.line.String(), " "); line != "" {
+			w.line.Reset()
+			w.line.WriteString(line + cellSeparator)
+		}
+		w.children(n)
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.P, atom.Table, atom.Blockquote, atom.Section, atom.Article, atom.Header, atom.Footer:
+		w.flush(2)
+		w.children(n)
+		w.flush(2)
+	case atom.Div, atom.Tr, atom.Dt, atom.Dd, atom.Caption:
+		w.flush(1)
+		w.children(n)
+		w.flush(1)
+	default:
+		w.children(n)
+	}
+}
+
+func (w *textWriter) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.walk(c)
+	}
+}
+
+// blockGap separates a top-level list from surrounding paragraphs by a
+// blank line but keeps nested lists tight.
+func blockGap(depth int) int {
+	if depth == 0 {
+		return 2
+	}
+	return 1
+}
+
+// text adds inline text, collapsing whitespace outside <pre>.
+func (w *textWriter) text(s string) {
+	if w.pre > 0 {
+		w.line.WriteString(s)
+		return
+	}
+	fields := strings.Fields(s)
+	if startsWithSpace(s) || len(fields) == 0 && s != "" {
+		w.space()
+	}
+	if len(fields) == 0 {
+		return
+	}
+	w.line.WriteString(strings.Join(fields, " "))
+	if endsWithSpace(s) {
+		w.space()
+	}
+}
+
+// space separates inline text by a single space.
+func (w *textWriter) space() {
+	if line := w.line.String(); line != "" && !strings.HasSuffix(line, " ") {
+		w.line.WriteByte(' ')
+	}
+}
+
+// flush writes out the current line, wrapped and indented for any lists
+// it is in, and asks for at least gap newlines before the next output.
+func (w *textWriter) flush(gap int) {
+	content := w.line.String()
+	w.line.Reset()
+	if w.pre == 0 {
+		content = strings.TrimSpace(content)
+	}
+	if content != "" {
+		indent := strings.Repeat("  ", max(len(w.lists)-1, 0))
+		if w.pre > 0 {
+			w.write(content)
+		} else {
+			first := indent + w.bullet
+			rest := indent + strings.Repeat(" ", len(w.bullet))
+			for i, line := range wrap(content, textWidth-len(first)) {
+				if i == 0 {
+					w.write(first + line)
+				} else {
+					w.out.WriteString("\n" + rest + line)
+				}
+			}
+		}
+		w.bullet = ""
+	}
+	w.pending = max(w.pending, gap)
+}
+
+// write emits s after any pending line breaks.
+func (w *textWriter) write(s string) {
+	if w.out.Len() > 0 {
+		w.out.WriteString(strings.Repeat("\n", max(w.pending, 1)))
+	}
+	w.pending = 0
+	w.out.WriteString(s)
+}
+
+// wrap breaks s into lines of at most width runes at spaces. Words longer
+// than width, such as URLs, are kept whole on a line of their own. Runs of
+// spaces, such as table cell separators, are kept unless they fall at a
+// line break.
+func wrap(s string, width int) []string {
+	var lines []string
+	var line strings.Builder
+	for _, word := range strings.Split(s, " ") {
+		if line.Len() > 0 && word != "" && utf8.RuneCountInString(line.String())+1+utf8.RuneCountInString(word) > width {
+			lines = append(lines, strings.TrimRight(line.String(), " "))
+			line.Reset()
+		}
+		if line.Len() > 0 {
+			line.WriteByte(' ')
+		}
+		line.WriteString(word)
+	}
+	if line.Len() > 0 {
+		lines = append(lines, strings.TrimRight(line.String(), " "))
+	}
+	return lines
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func startsWithSpace(s string) bool {
+	return s != "" && strings.ContainsAny(s[:1], " \t\r\n\f")
+}
+
+func endsWithSpace(s string) bool {
+	return s != "" && strings.ContainsAny(s[len(s)-1:], " \t\r\n\f")
+}
@@ -0,0 +1,80 @@
+package templates
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHTMLToText(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{
+			name: "paragraphs and line breaks",
+			html: "<p>Hello   Ann,</p>\n<p>Thanks for\n signing up.<br>See you soon.</p>",
+			want: "Hello Ann,\n\nThanks for signing up.\nSee you soon.\n",
+		},
+		{
+			name: "headings",
+			html: "<h1>Welcome</h1><p>Intro</p><h2>Next steps</h2><p>Confirm</p>",
+			want: "Welcome\n=======\n\nIntro\n\nNext steps\n----------\n\nConfirm\n",
+		},
+		{
+			name: "links",
+			html: `<p><a href="https://aptiverse.co.za/confirm">Confirm your email</a>, ` +
+				`<a href="https://aptiverse.co.za">https://aptiverse.co.za</a>, ` +
+				`<a href="#top">back to top</a> and <a href="mailto:help@aptiverse.co.za"></a></p>`,
+			want: "Confirm your email (https://aptiverse.co.za/confirm), https://aptiverse.co.za,\nback to top and mailto:help@aptiverse.co.za\n",
+		},
+		{
+			name: "nested lists",
+			html: "<p>Steps:</p><ol><li>Confirm<ul><li>Open the email</li><li>Click the link</li></ul></li><li>Sign in</li></ol><p>Done</p>",
+			want: "Steps:\n\n1. Confirm\n  * Open the email\n  * Click the link\n2. Sign in\n\nDone\n",
+		},
+		{
+			name: "tables are flattened",
+			html: "<table><tr><th>Plan</th><th>Price</th></tr><tr><td>Basic</td><td>R99</td></tr></table>",
+			want: "Plan  Price\nBasic  R99\n",
+		},
+		{
+			name: "head, style and script are dropped",
+			html: "<html><head><title>Title</title><style>p { color: red }</style></head>" +
+				"<body><script>alert(1)</script><noscript>Enable JavaScript</noscript><p>Body</p></body></html>",
+			want: "Body\n",
+		},
+		{
+			name: "wraps at 78 columns",
+			html: "<p>" + strings.Repeat("word ", 20) + "</p>",
+			want: strings.TrimSpace(strings.Repeat("word ", 15)) + "\n" + strings.TrimSpace(strings.Repeat("word ", 5)) + "\n",
+		},
+		{
+			name: "long urls stay whole",
+			html: "<p>Open https://aptiverse.co.za/confirm?token=" + strings.Repeat("a", 80) + " now</p>",
+			want: "Open\nhttps://aptiverse.co.za/confirm?token=" + strings.Repeat("a", 80) + "\nnow\n",
+		},
+		{
+			name: "list items wrap under their text",
+			html: "<ul><li>" + strings.Repeat("word ", 20) + "</li></ul>",
+			want: "* " + strings.TrimSpace(strings.Repeat("word ", 15)) + "\n  " + strings.TrimSpace(strings.Repeat("word ", 5)) + "\n",
+		},
+		{
+			name: "preformatted text is kept",
+			html: "<pre>code  block\n  indented</pre>",
+			want: "code  block\n  indented\n",
+		},
+		{
+			name: "images use their alt text",
+			html: `<p><img src="logo.png" alt="Aptiverse"> <img src="spacer.gif"></p><hr><p>Footer</p>`,
+			want: "Aptiverse\n\n" + strings.Repeat("-", 78) + "\n\nFooter\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HTMLToText(tt.html); got != tt.want {
+				t.Errorf("HTMLToText() =\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
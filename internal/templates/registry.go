@@ -0,0 +1,362 @@
+package templates
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+)
+
+// Template is an email that can be rendered by name. Subject and Text use
+// text/template syntax and HTML uses html/template, all over the same data.
+type Template struct {
+	Name    string
+	Subject string
+	// Subjects holds translated subjects keyed by locale, e.g. "pt-BR".
+	Subjects map[string]string
+	HTML     string
+	Text     string
+	// Required lists data fields that must be present and non-empty.
+	Required []string
+	// Layout names a layout that the HTML and text bodies fill in with
+	// {{define}} blocks. When empty the bodies are rendered as they are.
+	Layout string
+	// Schema is an optional JSON Schema that the data must satisfy.
+	Schema string
+	// Fixtures holds named sample data used to preview the template.
+	Fixtures map[string]map[string]any
+
+	schema    *schema
+	catalogs  map[string]catalog
+	subject   *texttemplate.Template
+	subjects  map[string]*texttemplate.Template
+	html      *htmltemplate.Template
+	text      *texttemplate.Template
+	htmlEntry string
+	textEntry string
+	reportCSS *sync.Once
+}
+
+// RenderOptions adjusts how a template is rendered for one email.
+type RenderOptions struct {
+	// Locale selects the message catalog and translated subject, falling
+	// back from "pt-BR" to "pt" to English.
+	Locale string
+	// Subject replaces the template's subject when set.
+	Subject string
+}
+
+// Rendered holds the output of a template for one email.
+type Rendered struct {
+	Subject string
+	HTML    string
+	Text    string
+	// UninlinedCSS describes the style rules that InlineCSS kept in the
+	// head or dropped.
+	UninlinedCSS []string
+}
+
+// MissingFieldsError reports required data fields that were not supplied.
+type MissingFieldsError struct {
+	Template string
+	Fields   []string
+}
+
+func (e *MissingFieldsError) Error() string {
+	return fmt.Sprintf("template %q requires %s", e.Template, strings.Join(e.Fields, ", "))
+}
+
+// Registry holds templates registered in code alongside those loaded from a
+// template directory. Loaded templates take precedence, so a directory can
+// override a built-in template by using its name.
+type Registry struct {
+	mu        sync.RWMutex
+	templates map[string]*Template
+	loaded    map[string]*Template
+	loadErr   error
+	changed   chan struct{}
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		templates: make(map[string]*Template),
+		loaded:    make(map[string]*Template),
+	}
+}
+
+// Register parses t and adds it to the registry. Names must be unique.
+func (r *Registry) Register(t Template) error {
+	if t.Name == "" {
+		return fmt.Errorf("template name is required")
+	}
+	if t.HTML == "" && t.Text == "" {
+		return fmt.Errorf("template %q needs an HTML or text body", t.Name)
+	}
+	if err := t.parse(builtinShared); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.templates[t.Name]; exists {
+		return fmt.Errorf("template %q is already registered", t.Name)
+	}
+	r.templates[t.Name] = &t
+	return nil
+}
+
+func (r *Registry) Lookup(name string) (*Template, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if t, ok := r.loaded[name]; ok {
+		return t, true
+	}
+	t, ok := r.templates[name]
+	return t, ok
+}
+
+// Names returns the registered template names in sorted order.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.templates)+len(r.loaded))
+	for name := range r.templates {
+		names = append(names, name)
+	}
+	for name := range r.loaded {
+		if _, ok := r.templates[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Changed returns a channel that is closed the next time the template
+// directory is loaded, whether or not the load succeeds.
+func (r *Registry) Changed() <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.changed == nil {
+		r.changed = make(chan struct{})
+	}
+	return r.changed
+}
+
+// LoadError returns the error from the last load of the template directory,
+// or nil if it succeeded.
+func (r *Registry) LoadError() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.loadErr
+}
+
+var defaultRegistry = NewRegistry()
+
+// Register adds t to the default registry.
+func Register(t Template) error {
+	return defaultRegistry.Register(t)
+}
+
+func Lookup(name string) (*Template, bool) {
+	return defaultRegistry.Lookup(name)
+}
+
+func Names() []string {
+	return defaultRegistry.Names()
+}
+
+func Changed() <-chan struct{} {
+	return defaultRegistry.Changed()
+}
+
+func LoadError() error {
+	return defaultRegistry.LoadError()
+}
+
+// parse compiles each part of t on top of its own copy of the layouts and
+// partials in s, reporting every part that fails.
+func (t *Template) parse(s *shared) error {
+	s, err := s.clone()
+	if err != nil {
+		return err
+	}
+
+	t.catalogs = s.catalogs
+	t.reportCSS = new(sync.Once)
+
+	var errs []error
+	if t.Schema != "" {
+		if t.schema, err = parseSchema([]byte(t.Schema)); err != nil {
+			errs = append(errs, fmt.Errorf("%s/schema.json: %v", t.Name, err))
+		}
+	}
+	if t.Subject != "" {
+		if t.subject, err = texttemplate.New(t.Name + "/subject.tmpl").Funcs(funcs).Parse(t.Subject); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	t.subjects = make(map[string]*texttemplate.Template, len(t.Subjects))
+	for locale, source := range t.Subjects {
+		subject, err := texttemplate.New(t.Name + "/subject." + locale + ".tmpl").Funcs(funcs).Parse(source)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		t.subjects[normalizeLocale(locale)] = subject
+	}
+	if t.HTML != "" {
+		t.htmlEntry = t.Name + "/html.tmpl"
+		if t.html, err = s.html.New(t.htmlEntry).Parse(t.HTML); err != nil {
+			errs = append(errs, err)
+		} else if t.Layout != "" {
+			if t.html.Lookup(t.Layout) == nil {
+				errs = append(errs, fmt.Errorf("%s: unknown layout %q", t.htmlEntry, t.Layout))
+			}
+			t.htmlEntry = t.Layout
+		}
+	}
+	if t.Text != "" {
+		t.textEntry = t.Name + "/text.tmpl"
+		if t.text, err = s.text.New(t.textEntry).Parse(t.Text); err != nil {
+			errs = append(errs, err)
+		} else if t.Layout != "" && t.text.Lookup(t.Layout) != nil {
+			// A layout may come without a text variant, in which case the
+			// text body stands on its own.
+			t.textEntry = t.Layout
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Render checks the data against the required fields and schema, then
+// executes each part of the template in the requested locale. The subject
+// is rendered first so that the bodies can show it with {{subject}}. Parts
+// the template does not define are left empty.
+func (t *Template) Render(data any, opts RenderOptions) (*Rendered, error) {
+	if t.schema != nil {
+		if problems := t.schema.validate("data", data, nil); len(problems) > 0 {
+			return nil, &SchemaError{Template: t.Name, Problems: problems}
+		}
+	}
+
+	var missing []string
+	for _, field := range t.Required {
+		if !hasField(data, field) {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, &MissingFieldsError{Template: t.Name, Fields: missing}
+	}
+
+	// The parsed templates are never executed themselves, which keeps them
+	// cloneable, so each render binds its own functions to a copy.
+	var rendered Rendered
+	tr := newTranslator(t.catalogs, opts.Locale)
+	bound := map[string]any{
+		"subject": func() string { return rendered.Subject },
+		"t":       tr.translate,
+		"locale":  func() string { return languageTag(tr.locale) },
+		"dir":     tr.direction,
+	}
+
+	var buf bytes.Buffer
+	rendered.Subject = opts.Subject
+	if subject := t.localizedSubject(opts.Locale); rendered.Subject == "" && subject != nil {
+		subject, err := subject.Clone()
+		if err != nil {
+			return nil, err
+		}
+		if err := subject.Funcs(bound).Execute(&buf, data); err != nil {
+			return nil, err
+		}
+		rendered.Subject = strings.TrimSpace(buf.String())
+	}
+
+	if t.html != nil {
+		html, err := t.html.Clone()
+		if err != nil {
+			return nil, err
+		}
+		buf.Reset()
+		if err := html.Funcs(bound).ExecuteTemplate(&buf, t.htmlEntry, data); err != nil {
+			return nil, err
+		}
+		rendered.HTML, rendered.UninlinedCSS, err = InlineCSS(buf.String())
+		if err != nil {
+			return nil, err
+		}
+		t.reportCSS.Do(func() {
+			if len(rendered.UninlinedCSS) > 0 {
+				log.Printf("Template %s has CSS that was not inlined:\n  %s", t.Name, strings.Join(rendered.UninlinedCSS, "\n  "))
+			}
+		})
+	}
+	if t.text != nil {
+		text, err := t.text.Clone()
+		if err != nil {
+			return nil, err
+		}
+		buf.Reset()
+		if err := text.Funcs(bound).ExecuteTemplate(&buf, t.textEntry, data); err != nil {
+			return nil, err
+		}
+		rendered.Text = buf.String()
+	} else if rendered.HTML != "" {
+		rendered.Text = HTMLToText(rendered.HTML)
+	}
+	return &rendered, nil
+}
+
+// Locales returns the locales that t has a message catalog for, sorted.
+func (t *Template) Locales() []string {
+	locales := make([]string, 0, len(t.catalogs))
+	for locale := range t.catalogs {
+		locales = append(locales, languageTag(locale))
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+func (t *Template) localizedSubject(locale string) *texttemplate.Template {
+	for _, l := range localeChain(locale) {
+		if subject, ok := t.subjects[l]; ok {
+			return subject
+		}
+	}
+	return t.subject
+}
+
+// hasField reports whether data, a struct or string-keyed map, holds a
+// non-zero value under name.
+func hasField(data any, name string) bool {
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return false
+		}
+		v = v.Elem()
+	}
+
+	var field reflect.Value
+	switch v.Kind() {
+	case reflect.Struct:
+		field = v.FieldByName(name)
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return false
+		}
+		field = v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+	}
+	if field.Kind() == reflect.Interface {
+		field = field.Elem()
+	}
+	return field.IsValid() && !field.IsZero()
+}
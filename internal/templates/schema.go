@@ -0,0 +1,218 @@
+package templates
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// schema is the subset of JSON Schema used to check template data before
+// rendering: type, required, properties, additionalProperties, items, enum,
+// minLength, maxLength, pattern, minimum, maximum and the email and uri
+// formats. Other keywords are ignored.
+type schema struct {
+	Type                 schemaType         `json:"type"`
+	Required             []string           `json:"required"`
+	Properties           map[string]*schema `json:"properties"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Items                *schema            `json:"items"`
+	Enum                 []any              `json:"enum"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Pattern              string             `json:"pattern"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	Format               string             `json:"format"`
+
+	pattern *regexp.Regexp
+}
+
+// schemaType accepts both "type": "string" and "type": ["string", "null"].
+type schemaType []string
+
+func (t *schemaType) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaType{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("type must be a string or an array of strings")
+	}
+	*t = list
+	return nil
+}
+
+func parseSchema(data []byte) (*schema, error) {
+	var s schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	if err := s.compile(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *schema) compile() error {
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", s.Pattern, err)
+		}
+		s.pattern = re
+	}
+	for _, prop := range s.Properties {
+		if err := prop.compile(); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.compile()
+	}
+	return nil
+}
+
+// SchemaError lists every way the data for a template breaks its schema.
+type SchemaError struct {
+	Template string
+	Problems []string
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("data for template %q does not match its schema: %s", e.Template, strings.Join(e.Problems, "; "))
+}
+
+// validate appends a problem for each violation found in value, which is
+// expected to hold decoded JSON. path locates value for the messages.
+func (s *schema) validate(path string, value any, problems []string) []string {
+	if n, ok := value.(int); ok {
+		value = float64(n)
+	}
+	if len(s.Type) > 0 && !s.matchesType(value) {
+		return append(problems, fmt.Sprintf("%s must be %s", path, strings.Join(s.Type, " or ")))
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, allowed := range s.Enum {
+			if reflect.DeepEqual(allowed, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("%s must be one of %v", path, s.Enum))
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		length := len([]rune(v))
+		if s.MinLength != nil && length < *s.MinLength {
+			problems = append(problems, fmt.Sprintf("%s must be at least %d characters", path, *s.MinLength))
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			problems = append(problems, fmt.Sprintf("%s must be at most %d characters", path, *s.MaxLength))
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			problems = append(problems, fmt.Sprintf("%s must match %s", path, s.Pattern))
+		}
+		if !matchesFormat(s.Format, v) {
+			problems = append(problems, fmt.Sprintf("%s must be a valid %s", path, s.Format))
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			problems = append(problems, fmt.Sprintf("%s must be at least %v", path, *s.Minimum))
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			problems = append(problems, fmt.Sprintf("%s must be at most %v", path, *s.Maximum))
+		}
+	case []any:
+		if s.Items != nil {
+			for i, item := range v {
+				problems = s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, problems)
+			}
+		}
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				problems = append(problems, fmt.Sprintf("%s is required", joinPath(path, name)))
+			}
+		}
+
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if prop, ok := s.Properties[key]; ok {
+				problems = prop.validate(joinPath(path, key), v[key], problems)
+			} else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				problems = append(problems, fmt.Sprintf("%s is not allowed", joinPath(path, key)))
+			}
+		}
+	}
+	return problems
+}
+
+func (s *schema) matchesType(value any) bool {
+	for _, t := range s.Type {
+		switch v := value.(type) {
+		case nil:
+			if t == "null" {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case float64:
+			if t == "number" || (t == "integer" && v == math.Trunc(v)) {
+				return true
+			}
+		case []any:
+			if t == "array" {
+				return true
+			}
+		case map[string]any:
+			if t == "object" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchesFormat(format, value string) bool {
+	switch format {
+	case "email":
+		// A bare address only, not "Name <address>".
+		addr, err := mail.ParseAddress(value)
+		return err == nil && addr.Address == value
+	case "uri":
+		u, err := url.Parse(value)
+		return err == nil && u.Scheme != ""
+	default:
+		return true
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,168 @@
+package templates
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	s, err := parseSchema([]byte(`{
+		"type": "object",
+		"required": ["name", "link"],
+		"additionalProperties": false,
+		"properties": {
+			"name": {"type": "string", "minLength": 1, "maxLength": 5},
+			"link": {"type": "string", "format": "uri"},
+			"email": {"type": "string", "format": "email"},
+			"code": {"type": "string", "pattern": "^[A-Z]{3}-[0-9]+$"},
+			"plan": {"enum": ["basic", "pro", 3]},
+			"count": {"type": "integer", "minimum": 1, "maximum": 10},
+			"price": {"type": "number"},
+			"nickname": {"type": ["string", "null"]},
+			"tags": {"type": "array", "items": {"type": "string"}}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{
+			name: "valid",
+			data: `{"name": "Ann", "link": "https://aptiverse.co.za/confirm", "email": "ann@example.com", "code": "ABC-12",
+				"plan": "pro", "count": 3, "price": 9.99, "nickname": null, "tags": ["a", "b"]}`,
+		},
+		{
+			name: "missing required fields",
+			data: `{}`,
+			want: []string{"data.name is required", "data.link is required"},
+		},
+		{
+			name: "not an object",
+			data: `"Ann"`,
+			want: []string{"data must be object"},
+		},
+		{
+			name: "string lengths",
+			data: `{"name": "", "link": "https://a.co"}`,
+			want: []string{"data.name must be at least 1 characters"},
+		},
+		{
+			name: "length counts characters",
+			data: `{"name": "Zoëé", "link": "https://a.co"}`,
+		},
+		{
+			name: "type lists",
+			data: `{"name": "Ann", "link": "https://a.co", "nickname": 5}`,
+			want: []string{"data.nickname must be string or null"},
+		},
+		{
+			name: "integer and number",
+			data: `{"name": "Ann", "link": "https://a.co", "count": 2.5, "price": 2}`,
+			want: []string{"data.count must be integer"},
+		},
+		{
+			name: "integer bounds",
+			data: `{"name": "Ann", "link": "https://a.co", "count": 11}`,
+			want: []string{"data.count must be at most 10"},
+		},
+		{
+			name: "enum",
+			data: `{"name": "Ann", "link": "https://a.co", "plan": "gold"}`,
+			want: []string{"data.plan must be one of [basic pro 3]"},
+		},
+		{
+			name: "enum compares types",
+			data: `{"name": "Ann", "link": "https://a.co", "plan": "3"}`,
+			want: []string{"data.plan must be one of [basic pro 3]"},
+		},
+		{
+			name: "enum number",
+			data: `{"name": "Ann", "link": "https://a.co", "plan": 3}`,
+		},
+		{
+			name: "pattern",
+			data: `{"name": "Ann", "link": "https://a.co", "code": "abc-12"}`,
+			want: []string{"data.code must match ^[A-Z]{3}-[0-9]+$"},
+		},
+		{
+			name: "uri format",
+			data: `{"name": "Ann", "link": "aptiverse.co.za/confirm"}`,
+			want: []string{"data.link must be a valid uri"},
+		},
+		{
+			name: "email format",
+			data: `{"name": "Ann", "link": "https://a.co", "email": "not an email"}`,
+			want: []string{"data.email must be a valid email"},
+		},
+		{
+			name: "email format is a bare address",
+			data: `{"name": "Ann", "link": "https://a.co", "email": "Ann <ann@example.com>"}`,
+			want: []string{"data.email must be a valid email"},
+		},
+		{
+			name: "array items",
+			data: `{"name": "Ann", "link": "https://a.co", "tags": ["a", 1]}`,
+			want: []string{"data.tags[1] must be string"},
+		},
+		{
+			name: "additional properties",
+			data: `{"name": "Ann", "link": "https://a.co", "extra": true}`,
+			want: []string{"data.extra is not allowed"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var data any
+			if err := json.Unmarshal([]byte(tt.data), &data); err != nil {
+				t.Fatal(err)
+			}
+			if got := s.validate("data", data, nil); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchemaAcceptsGoIntegers(t *testing.T) {
+	s, err := parseSchema([]byte(`{"type": "integer", "minimum": 1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problems := s.validate("count", 3, nil); len(problems) > 0 {
+		t.Errorf("validate(3) = %q", problems)
+	}
+	if problems := s.validate("count", 0, nil); len(problems) != 1 {
+		t.Errorf("validate(0) = %q, want the minimum violated", problems)
+	}
+}
+
+func TestParseSchemaRejectsBadPatterns(t *testing.T) {
+	if _, err := parseSchema([]byte(`{"properties": {"code": {"pattern": "["}}}`)); err == nil {
+		t.Error("parseSchema accepted an invalid nested pattern")
+	}
+	if _, err := parseSchema([]byte(`{"type": 5}`)); err == nil {
+		t.Error("parseSchema accepted a numeric type")
+	}
+}
+
+func TestRenderReportsSchemaErrors(t *testing.T) {
+	tmpl, ok := Lookup("email_confirmation")
+	if !ok {
+		t.Fatal("email_confirmation is not registered")
+	}
+	_, err := tmpl.Render(map[string]any{"firstName": "Ann", "confirmationLink": "not a link"}, RenderOptions{})
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) {
+		t.Fatalf("Render() = %v, want a SchemaError", err)
+	}
+	if want := []string{"data.confirmationLink must be a valid uri"}; !reflect.DeepEqual(schemaErr.Problems, want) {
+		t.Errorf("problems = %q, want %q", schemaErr.Problems, want)
+	}
+}
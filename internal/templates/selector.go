@@ -0,0 +1,241 @@
+package templates
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// selector is a parsed CSS selector made of compound selectors joined by
+// descendant (' ') or child ('>') combinators. Only what can be decided
+// from the document alone is supported: type, class, id and attribute
+// selectors and the :first-child and :last-child pseudo-classes.
+type selector struct {
+	parts       []compound
+	combinators []byte
+}
+
+type compound struct {
+	tag        string
+	id         string
+	classes    []string
+	attrs      []attrSelector
+	firstChild bool
+	lastChild  bool
+}
+
+type attrSelector struct {
+	key      string
+	value    string
+	hasValue bool
+}
+
+func parseSelector(source string) (selector, error) {
+	var sel selector
+	var current compound
+	empty := true
+	combinator := byte(0)
+
+	finish := func() {
+		if empty {
+			return
+		}
+		if len(sel.parts) > 0 {
+			if combinator == 0 {
+				combinator = ' '
+			}
+			sel.combinators = append(sel.combinators, combinator)
+		}
+		sel.parts = append(sel.parts, current)
+		current, empty, combinator = compound{}, true, 0
+	}
+
+	for i := 0; i < len(source); {
+		c := source[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			finish()
+			i++
+		case c == '>':
+			finish()
+			if len(sel.parts) == 0 || combinator != 0 {
+				return sel, errors.New("misplaced '>'")
+			}
+			combinator = '>'
+			i++
+		case c == '+' || c == '~':
+			return sel, errors.New("sibling combinators are not supported")
+		case c == '*':
+			empty = false
+			i++
+		case c == '#':
+			name, n := readIdent(source[i+1:])
+			current.id, empty = name, false
+			i += 1 + n
+		case c == '.':
+			name, n := readIdent(source[i+1:])
+			current.classes, empty = append(current.classes, name), false
+			i += 1 + n
+		case c == '[':
+			end := strings.IndexByte(source[i:], ']')
+			if end < 0 {
+				return sel, errors.New("unterminated attribute selector")
+			}
+			inner := source[i+1 : i+end]
+			key, value, hasValue := strings.Cut(inner, "=")
+			if strings.ContainsAny(key, "~|^$*") {
+				return sel, fmt.Errorf("attribute operator in [%s] is not supported", inner)
+			}
+			current.attrs = append(current.attrs, attrSelector{
+				key:      strings.ToLower(strings.TrimSpace(key)),
+				value:    strings.Trim(strings.TrimSpace(value), `"'`),
+				hasValue: hasValue,
+			})
+			empty = false
+			i += end + 1
+		case c == ':':
+			if strings.HasPrefix(source[i:], "::") {
+				return sel, errors.New("pseudo-elements cannot be inlined")
+			}
+			name, n := readIdent(source[i+1:])
+			switch strings.ToLower(name) {
+			case "first-child":
+				current.firstChild = true
+			case "last-child":
+				current.lastChild = true
+			case "before", "after", "first-line", "first-letter":
+				return sel, errors.New("pseudo-elements cannot be inlined")
+			default:
+				return sel, fmt.Errorf(":%s cannot be inlined", name)
+			}
+			empty = false
+			i += 1 + n
+		default:
+			name, n := readIdent(source[i:])
+			if n == 0 {
+				return sel, fmt.Errorf("unexpected %q", c)
+			}
+			current.tag, empty = strings.ToLower(name), false
+			i += n
+		}
+	}
+	finish()
+	if len(sel.parts) == 0 || combinator != 0 {
+		return sel, errors.New("incomplete selector")
+	}
+	return sel, nil
+}
+
+func readIdent(s string) (string, int) {
+	n := 0
+	for n < len(s) {
+		c := s[n]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c >= 0x80 {
+			n++
+			continue
+		}
+		break
+	}
+	return s[:n], n
+}
+
+// specificity counts ids, then classes, attributes and pseudo-classes,
+// then type selectors.
+func (s selector) specificity() [3]int {
+	var spec [3]int
+	for _, part := range s.parts {
+		if part.id != "" {
+			spec[0]++
+		}
+		spec[1] += len(part.classes) + len(part.attrs)
+		if part.firstChild {
+			spec[1]++
+		}
+		if part.lastChild {
+			spec[1]++
+		}
+		if part.tag != "" {
+			spec[2]++
+		}
+	}
+	return spec
+}
+
+func (s selector) matches(n *html.Node) bool {
+	return s.matchFrom(len(s.parts)-1, n)
+}
+
+func (s selector) matchFrom(i int, n *html.Node) bool {
+	if !s.parts[i].matches(n) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	if s.combinators[i-1] == '>' {
+		parent := n.Parent
+		return parent != nil && parent.Type == html.ElementNode && s.matchFrom(i-1, parent)
+	}
+	for a := n.Parent; a != nil && a.Type == html.ElementNode; a = a.Parent {
+		if s.matchFrom(i-1, a) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c compound) matches(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	if c.tag != "" && c.tag != n.Data {
+		return false
+	}
+	if c.id != "" && attr(n, "id") != c.id {
+		return false
+	}
+	if len(c.classes) > 0 {
+		classes := strings.Fields(attr(n, "class"))
+		for _, want := range c.classes {
+			found := false
+			for _, have := range classes {
+				if have == want {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	for _, a := range c.attrs {
+		value, ok := "", false
+		for _, have := range n.Attr {
+			if have.Key == a.key {
+				value, ok = have.Val, true
+				break
+			}
+		}
+		if !ok || a.hasValue && value != a.value {
+			return false
+		}
+	}
+	if c.firstChild {
+		for p := n.PrevSibling; p != nil; p = p.PrevSibling {
+			if p.Type == html.ElementNode {
+				return false
+			}
+		}
+	}
+	if c.lastChild {
+		for p := n.NextSibling; p != nil; p = p.NextSibling {
+			if p.Type == html.ElementNode {
+				return false
+			}
+		}
+	}
+	return true
+}